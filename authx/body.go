@@ -0,0 +1,173 @@
+package authutil
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"io"
+	"net/http"
+	"os"
+	"strconv"
+
+	errorutil "github.com/XuThreeFire/goutil/errorx"
+)
+
+// HeaderBodyHash is the header of the lower hex sha256 of the body in the hash-of-body mode,
+// the hash is signed instead of the body so a client can hash a streaming or multipart
+// body as it sends it.
+const HeaderBodyHash = "Body-Hash"
+
+// DefaultMaxBodySize is the default max size of a body buffered for the signature.
+const DefaultMaxBodySize = 10 << 20
+
+// DefaultMaxHashedBodySize is the default max size of a body in the hash-of-body mode.
+const DefaultMaxHashedBodySize = 1 << 30
+
+// BodyHash returns the lower hex sha256 of the body.
+func BodyHash(body []byte) string {
+	sum := sha256.Sum256(body)
+	return hex.EncodeToString(sum[:])
+}
+
+type bodyKey struct{}
+
+// NewBodyContext returns a new Context that carries the raw body read before decoding.
+func NewBodyContext(ctx context.Context, body []byte) context.Context {
+	return context.WithValue(ctx, bodyKey{}, body)
+}
+
+// BodyFromContext returns the raw body in ctx if any.
+func BodyFromContext(ctx context.Context) ([]byte, bool) {
+	body, ok := ctx.Value(bodyKey{}).([]byte)
+	return body, ok
+}
+
+type bodyHashKey struct{}
+
+// NewBodyHashContext returns a new Context that carries the Body-Hash a body in the
+// hash-of-body mode was checked against by ReadBody before decoding.
+func NewBodyHashContext(ctx context.Context, hash string) context.Context {
+	return context.WithValue(ctx, bodyHashKey{}, hash)
+}
+
+// ReadBody reads the body of the signed request from r and rewinds r.Body for the handlers.
+// The raw body of the context is used if it was read before decoding.
+// A body larger than MaxBodySize is rejected with ErrIllegalRequest.
+// In the hash-of-body mode the body is not buffered in memory, it is hashed while it is
+// spooled to a temporary file, at most MaxHashedBodySize, and rejected with ErrSignatureError
+// before the handlers if it does not match the Body-Hash header, which must be a lower
+// hex sha256. r.Body then reads the file, which is already removed, close r.Body to
+// release it.
+func (o *Options) ReadBody(r *http.Request, sr *Request) error {
+	if h := r.Header.Get(HeaderBodyHash); h != "" {
+		if !isBodyHash(h) {
+			return errorutil.ErrSignatureError.WithMessage("invalid Body-Hash")
+		}
+		sr.BodyHash = h
+		if checked, ok := r.Context().Value(bodyHashKey{}).(string); ok && checked == h {
+			sr.bodyChecked = true
+			return nil
+		}
+		if body, ok := BodyFromContext(r.Context()); ok {
+			sr.Body = body
+			return sr.checkBodyHash()
+		}
+		return o.spoolBody(r, sr)
+	}
+	if body, ok := BodyFromContext(r.Context()); ok {
+		sr.Body = body
+		return nil
+	}
+	if r.Body == nil || r.Body == http.NoBody {
+		return nil
+	}
+	body, err := io.ReadAll(io.LimitReader(r.Body, o.MaxBodySize+1))
+	r.Body.Close()
+	if err != nil {
+		return errorutil.ErrEmptyParam.WithCause(err)
+	}
+	if int64(len(body)) > o.MaxBodySize {
+		return errorutil.ErrIllegalRequest.WithMessage("body exceeds " + strconv.FormatInt(o.MaxBodySize, 10) + " bytes")
+	}
+	r.Body = io.NopCloser(bytes.NewReader(body))
+	sr.Body = body
+	return nil
+}
+
+// spoolBody copies the body of the hash-of-body mode to a temporary file while hashing it.
+func (o *Options) spoolBody(r *http.Request, sr *Request) error {
+	if r.Body == nil || r.Body == http.NoBody {
+		return sr.checkBodyHash()
+	}
+	f, err := os.CreateTemp("", "authutil-body-*")
+	if err != nil {
+		return errorutil.ErrInternalError.WithCause(err)
+	}
+	// removed at once where an open file can be, so it is not left behind by a handler
+	// that does not close the body
+	os.Remove(f.Name())
+	body := &spooledBody{File: f}
+	h := sha256.New()
+	n, err := io.Copy(io.MultiWriter(f, h), io.LimitReader(r.Body, o.MaxHashedBodySize+1))
+	r.Body.Close()
+	if err != nil {
+		body.Close()
+		return errorutil.ErrEmptyParam.WithCause(err)
+	}
+	if n > o.MaxHashedBodySize {
+		body.Close()
+		return errorutil.ErrIllegalRequest.WithMessage("body exceeds " + strconv.FormatInt(o.MaxHashedBodySize, 10) + " bytes")
+	}
+	if subtle.ConstantTimeCompare([]byte(hex.EncodeToString(h.Sum(nil))), []byte(sr.BodyHash)) != 1 {
+		body.Close()
+		return errorutil.ErrSignatureError.WithMessage("body hash mismatch")
+	}
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		body.Close()
+		return errorutil.ErrInternalError.WithCause(err)
+	}
+	r.Body = body
+	sr.bodyChecked = true
+	return nil
+}
+
+// spooledBody is a body spooled to a temporary file, removed on Close if it was not yet.
+type spooledBody struct {
+	*os.File
+}
+
+func (b *spooledBody) Close() error {
+	err := b.File.Close()
+	os.Remove(b.Name())
+	return err
+}
+
+// checkBodyHash returns ErrSignatureError if the request is in the hash-of-body mode
+// and the body does not match the hash.
+func (r *Request) checkBodyHash() error {
+	if r.BodyHash == "" || r.bodyChecked {
+		return nil
+	}
+	if !isBodyHash(r.BodyHash) {
+		return errorutil.ErrSignatureError.WithMessage("invalid Body-Hash")
+	}
+	if subtle.ConstantTimeCompare([]byte(BodyHash(r.Body)), []byte(r.BodyHash)) != 1 {
+		return errorutil.ErrSignatureError.WithMessage("body hash mismatch")
+	}
+	return nil
+}
+
+// isBodyHash reports whether h is a lower hex sha256.
+func isBodyHash(h string) bool {
+	if len(h) != 2*sha256.Size {
+		return false
+	}
+	for _, c := range h {
+		if (c < '0' || c > '9') && (c < 'a' || c > 'f') {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,113 @@
+package authutil
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	errorutil "github.com/XuThreeFire/goutil/errorx"
+)
+
+func TestReadBody(t *testing.T) {
+	o := NewOptions(WithMaxBodySize(8))
+
+	r := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(`{"id":1}`))
+	sr := &Request{}
+	if err := o.ReadBody(r, sr); err != nil {
+		t.Fatal(err)
+	}
+	if rest, _ := io.ReadAll(r.Body); string(sr.Body) != `{"id":1}` || string(rest) != `{"id":1}` {
+		t.Errorf("ReadBody() body = %s, rewound = %s", sr.Body, rest)
+	}
+
+	r = httptest.NewRequest(http.MethodPost, "/", strings.NewReader(`{"id":10}`))
+	if err := o.ReadBody(r, &Request{}); !errorutil.ErrIllegalRequest.Is(err) {
+		t.Errorf("ReadBody() too large = %v", err)
+	}
+
+	r = httptest.NewRequest(http.MethodPost, "/", strings.NewReader("decoded"))
+	r = r.WithContext(NewBodyContext(r.Context(), []byte("raw")))
+	sr = &Request{}
+	if err := o.ReadBody(r, sr); err != nil || string(sr.Body) != "raw" {
+		t.Errorf("ReadBody() from context = %s, %v", sr.Body, err)
+	}
+}
+
+func TestReadBodyHash(t *testing.T) {
+	ctx := context.Background()
+	body := strings.Repeat("multipart", 10)
+	client := &Request{User: "user", Method: "Upload", Body: []byte(body)}
+	if err := NewOptions(WithBodyHash()).Sign(ctx, client, "key"); err != nil {
+		t.Fatal(err)
+	}
+
+	// a body over MaxBodySize is spooled rather than buffered
+	o := NewOptions(WithMaxBodySize(16), WithMaxHashedBodySize(128))
+	for _, tt := range []struct {
+		body    string
+		wantErr bool
+	}{
+		{body, false},
+		{body + "tampered", true},
+	} {
+		r := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(tt.body))
+		client.SetHeader(r.Header.Set)
+		sr := RequestFromHeader(r.Header.Get)
+		err := o.ReadBody(r, sr)
+		if gotErr := errorutil.ErrSignatureError.Is(err); gotErr != tt.wantErr {
+			t.Errorf("ReadBody(%q) = %v, want error %v", tt.body, err, tt.wantErr)
+		}
+		if err == nil {
+			if err := o.Verify(ctx, sr, "key"); err != nil {
+				t.Errorf("Verify() = %v", err)
+			}
+			if rest, _ := io.ReadAll(r.Body); sr.Body != nil || string(rest) != tt.body {
+				t.Errorf("ReadBody() buffered %d bytes, rewound = %s", len(sr.Body), rest)
+			}
+			r.Body.Close()
+		}
+		// the body check runs in Verify too, whoever read the body
+		sr.Body = []byte(tt.body)
+		if err := o.Verify(ctx, sr, "key"); errorutil.ErrSignatureError.Is(err) != tt.wantErr {
+			t.Errorf("Verify(%q) = %v, want error %v", tt.body, err, tt.wantErr)
+		}
+	}
+
+	large := &Request{User: "user", Method: "Upload", Body: []byte(strings.Repeat(body, 2))}
+	if err := NewOptions(WithBodyHash()).Sign(ctx, large, "key"); err != nil {
+		t.Fatal(err)
+	}
+	r := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(string(large.Body)))
+	large.SetHeader(r.Header.Set)
+	if err := o.ReadBody(r, RequestFromHeader(r.Header.Get)); !errorutil.ErrIllegalRequest.Is(err) {
+		t.Errorf("ReadBody() over the hashed body size = %v", err)
+	}
+
+	r = httptest.NewRequest(http.MethodPost, "/", strings.NewReader(body))
+	client.SetHeader(r.Header.Set)
+	r.Header.Set(HeaderBodyHash, strings.ToUpper(client.BodyHash))
+	if err := o.ReadBody(r, RequestFromHeader(r.Header.Get)); !errorutil.ErrSignatureError.Is(err) {
+		t.Errorf("ReadBody() upper case hash = %v", err)
+	}
+}
+
+func TestBodyHashMode(t *testing.T) {
+	ctx := context.Background()
+	o := NewOptions(WithSkew(0))
+	for _, alg := range []string{AlgMD5, AlgHMACSHA256, AlgHMACSHA256V2} {
+		// a request signed on its body, whose body is the hash of another body
+		other := []byte("other body")
+		client := &Request{User: "user", Method: "Upload", Body: []byte(BodyHash(other))}
+		if err := NewOptions(WithAlg(alg)).Sign(ctx, client, "key"); err != nil {
+			t.Fatal(err)
+		}
+		replayed := *client
+		replayed.Body, replayed.BodyHash = other, string(client.Body)
+		if err := o.Verify(ctx, &replayed, "key"); !errorutil.ErrSignatureError.Is(err) {
+			t.Errorf("%s replayed in the hash-of-body mode = %v", alg, err)
+		}
+	}
+}
@@ -0,0 +1,28 @@
+package authutil
+
+import "context"
+
+// ContextKey is the type of the context keys of the authenticated caller,
+// shared by the kratos and go-kit middlewares.
+type ContextKey string
+
+const (
+	// ContextKeyUserName UserName 认证的用户名
+	ContextKeyUserName ContextKey = "UserName"
+
+	// ContextKeyPartnerId PartnerId 认证的partnerId
+	ContextKeyPartnerId ContextKey = "PartnerId"
+)
+
+type claimsKey struct{}
+
+// NewClaimsContext returns a new Context that carries the claims of the bearer token.
+func NewClaimsContext(ctx context.Context, claims Claims) context.Context {
+	return context.WithValue(ctx, claimsKey{}, claims)
+}
+
+// ClaimsFromContext returns the claims of the bearer token in ctx if any.
+func ClaimsFromContext(ctx context.Context) (Claims, bool) {
+	claims, ok := ctx.Value(claimsKey{}).(Claims)
+	return claims, ok
+}
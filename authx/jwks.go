@@ -0,0 +1,265 @@
+package authutil
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math/big"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	errorutil "github.com/XuThreeFire/goutil/errorx"
+)
+
+// Default JWKS cache settings.
+const (
+	DefaultJWKSTTL        = 10 * time.Minute
+	DefaultJWKSMinRefresh = 30 * time.Second
+	DefaultJWKSTimeout    = 10 * time.Second
+)
+
+// JWKS is a KeySource of a JSON Web Key Set loaded from a local file or an http(s) URL.
+// The keys are cached for a ttl, and refreshed earlier for an unknown kid. The set is
+// fetched at most once per min refresh interval, even while it failed to load, so an
+// outage of the endpoint is not a stampede on it. A failed refresh keeps the cached keys.
+// One fetch is in flight at a time, with a timeout of its own rather than the context of
+// a caller, the callers without a cached key wait for it.
+type JWKS struct {
+	source     string
+	client     *http.Client
+	ttl        time.Duration
+	minRefresh time.Duration
+	timeout    time.Duration
+
+	mu        sync.Mutex
+	keys      map[string]interface{}
+	err       error // of the last fetch
+	fetchedAt time.Time
+	fetching  chan struct{} // closed when the fetch in flight completes
+	now       func() time.Time
+}
+
+// JWKSOption is jwks option.
+type JWKSOption func(*JWKS)
+
+// WithJWKSClient with the http client fetching a URL, http.DefaultClient by default.
+func WithJWKSClient(client *http.Client) JWKSOption {
+	return func(s *JWKS) {
+		s.client = client
+	}
+}
+
+// WithJWKSTTL with the cache ttl of the keys, DefaultJWKSTTL by default.
+func WithJWKSTTL(ttl time.Duration) JWKSOption {
+	return func(s *JWKS) {
+		s.ttl = ttl
+	}
+}
+
+// WithJWKSMinRefresh with the min interval of the refreshes for an unknown kid, DefaultJWKSMinRefresh by default.
+func WithJWKSMinRefresh(interval time.Duration) JWKSOption {
+	return func(s *JWKS) {
+		s.minRefresh = interval
+	}
+}
+
+// WithJWKSTimeout with the timeout of a fetch, DefaultJWKSTimeout by default.
+func WithJWKSTimeout(timeout time.Duration) JWKSOption {
+	return func(s *JWKS) {
+		s.timeout = timeout
+	}
+}
+
+// NewJWKS news a JWKS of a file path or an http(s) URL, loaded on the first use.
+func NewJWKS(source string, opts ...JWKSOption) *JWKS {
+	s := &JWKS{
+		source:     source,
+		client:     http.DefaultClient,
+		ttl:        DefaultJWKSTTL,
+		minRefresh: DefaultJWKSMinRefresh,
+		timeout:    DefaultJWKSTimeout,
+		now:        time.Now,
+	}
+	for _, o := range opts {
+		o(s)
+	}
+	return s
+}
+
+// Key returns the key of the kid, the only key of the set if kid is empty.
+func (s *JWKS) Key(ctx context.Context, kid, alg string) (interface{}, error) {
+	s.mu.Lock()
+	_, ok := s.lookup(kid)
+	if s.fetching == nil && s.stale(ok) {
+		s.fetching = make(chan struct{})
+		s.fetchedAt = s.now()
+		go s.refresh(s.fetching)
+	}
+	wait := s.fetching
+	if ok || wait == nil {
+		defer s.mu.Unlock()
+		return s.cached(kid)
+	}
+	s.mu.Unlock()
+	select {
+	case <-wait:
+	case <-ctx.Done():
+		return nil, errorutil.ErrInternalError.WithCause(ctx.Err())
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.cached(kid)
+}
+
+// stale reports whether the set is fetched again, ok is whether the kid is cached.
+func (s *JWKS) stale(ok bool) bool {
+	if s.fetchedAt.IsZero() {
+		return true
+	}
+	age := s.now().Sub(s.fetchedAt)
+	if age < s.minRefresh {
+		return false
+	}
+	return !ok || age >= s.ttl
+}
+
+// refresh fetches the set and closes done.
+func (s *JWKS) refresh(done chan struct{}) {
+	ctx, cancel := context.WithTimeout(context.Background(), s.timeout)
+	defer cancel()
+	keys, err := s.fetch(ctx)
+	s.mu.Lock()
+	if err == nil {
+		s.keys = keys
+	}
+	s.err = err
+	s.fetching = nil
+	close(done)
+	s.mu.Unlock()
+}
+
+// cached returns the cached key of the kid, the error of the last fetch if the set was
+// never loaded. s.mu is held.
+func (s *JWKS) cached(kid string) (interface{}, error) {
+	if s.keys == nil {
+		err := s.err
+		if err == nil {
+			err = fmt.Errorf("jwks: %s not loaded", s.source)
+		}
+		return nil, errorutil.ErrInternalError.WithCause(err)
+	}
+	key, ok := s.lookup(kid)
+	if !ok {
+		return nil, invalidToken("unknown kid " + kid)
+	}
+	return key, nil
+}
+
+func (s *JWKS) lookup(kid string) (interface{}, bool) {
+	if kid == "" && len(s.keys) == 1 {
+		for _, key := range s.keys {
+			return key, true
+		}
+	}
+	key, ok := s.keys[kid]
+	return key, ok
+}
+
+func (s *JWKS) fetch(ctx context.Context) (map[string]interface{}, error) {
+	data, err := s.load(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return ParseJWKS(data)
+}
+
+func (s *JWKS) load(ctx context.Context) ([]byte, error) {
+	if !strings.HasPrefix(s.source, "http://") && !strings.HasPrefix(s.source, "https://") {
+		return os.ReadFile(s.source)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, s.source, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("jwks: %s %s", s.source, resp.Status)
+	}
+	return io.ReadAll(resp.Body)
+}
+
+// ParseJWKS parses a JSON Web Key Set into the keys by kid, the RSA, EC P-256
+// and oct keys are supported, the other keys are skipped.
+func ParseJWKS(data []byte) (map[string]interface{}, error) {
+	var set struct {
+		Keys []struct {
+			Kty string `json:"kty"`
+			Kid string `json:"kid"`
+			Use string `json:"use"`
+			Crv string `json:"crv"`
+			N   string `json:"n"`
+			E   string `json:"e"`
+			X   string `json:"x"`
+			Y   string `json:"y"`
+			K   string `json:"k"`
+		} `json:"keys"`
+	}
+	if err := json.Unmarshal(data, &set); err != nil {
+		return nil, err
+	}
+	keys := make(map[string]interface{}, len(set.Keys))
+	for _, k := range set.Keys {
+		if k.Use != "" && k.Use != "sig" {
+			continue
+		}
+		switch {
+		case k.Kty == "RSA":
+			n, err := decodeBigInt(k.N)
+			if err != nil {
+				return nil, err
+			}
+			e, err := decodeBigInt(k.E)
+			if err != nil {
+				return nil, err
+			}
+			keys[k.Kid] = &rsa.PublicKey{N: n, E: int(e.Int64())}
+		case k.Kty == "EC" && k.Crv == "P-256":
+			x, err := decodeBigInt(k.X)
+			if err != nil {
+				return nil, err
+			}
+			y, err := decodeBigInt(k.Y)
+			if err != nil {
+				return nil, err
+			}
+			keys[k.Kid] = &ecdsa.PublicKey{Curve: elliptic.P256(), X: x, Y: y}
+		case k.Kty == "oct":
+			secret, err := base64.RawURLEncoding.DecodeString(k.K)
+			if err != nil {
+				return nil, err
+			}
+			keys[k.Kid] = secret
+		}
+	}
+	return keys, nil
+}
+
+func decodeBigInt(s string) (*big.Int, error) {
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, err
+	}
+	return new(big.Int).SetBytes(b), nil
+}
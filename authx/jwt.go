@@ -0,0 +1,317 @@
+package authutil
+
+import (
+	"bytes"
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/hmac"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"strings"
+	"time"
+
+	errorutil "github.com/XuThreeFire/goutil/errorx"
+)
+
+// JWT algorithms, "none" is never accepted.
+const (
+	AlgHS256 = "HS256"
+	AlgRS256 = "RS256"
+	AlgES256 = "ES256"
+)
+
+// HeaderAuthorization is the header of the bearer token.
+const HeaderAuthorization = "Authorization"
+
+// DefaultLeeway is the default accepted clock difference of the exp and nbf claims.
+const DefaultLeeway = 30 * time.Second
+
+// KeySource returns the key verifying a token, a []byte secret for HS256,
+// an *rsa.PublicKey for RS256 and an *ecdsa.PublicKey for ES256.
+type KeySource interface {
+	Key(ctx context.Context, kid, alg string) (interface{}, error)
+}
+
+// KeySourceFunc is a function KeySource.
+type KeySourceFunc func(ctx context.Context, kid, alg string) (interface{}, error)
+
+// Key calls f.
+func (f KeySourceFunc) Key(ctx context.Context, kid, alg string) (interface{}, error) {
+	return f(ctx, kid, alg)
+}
+
+// StaticKey returns a KeySource of one key whatever the kid.
+func StaticKey(key interface{}) KeySource {
+	return KeySourceFunc(func(context.Context, string, string) (interface{}, error) {
+		return key, nil
+	})
+}
+
+// Claims is the claims of a verified token.
+type Claims map[string]interface{}
+
+// String returns the claim as a string, numbers are formatted, empty if absent.
+func (c Claims) String(name string) string {
+	switch v := c[name].(type) {
+	case string:
+		return v
+	case json.Number:
+		return v.String()
+	}
+	return ""
+}
+
+// Audience returns the aud claim, a string or an array of strings.
+func (c Claims) Audience() []string {
+	switch v := c["aud"].(type) {
+	case string:
+		return []string{v}
+	case []interface{}:
+		aud := make([]string, 0, len(v))
+		for _, a := range v {
+			if s, ok := a.(string); ok {
+				aud = append(aud, s)
+			}
+		}
+		return aud
+	}
+	return nil
+}
+
+// time returns the NumericDate claim, false if it is absent and an error if it is not a number.
+func (c Claims) time(name string) (time.Time, bool, error) {
+	v, ok := c[name]
+	if !ok {
+		return time.Time{}, false, nil
+	}
+	n, ok := v.(json.Number)
+	if !ok {
+		return time.Time{}, false, invalidToken("bad " + name + " claim")
+	}
+	f, err := n.Float64()
+	if err != nil {
+		return time.Time{}, false, invalidToken("bad " + name + " claim")
+	}
+	return time.Unix(int64(f), 0), true, nil
+}
+
+// JWTVerifier verifies the bearer tokens and maps their claims into the context.
+type JWTVerifier struct {
+	keys           KeySource
+	algs           []string
+	issuer         string
+	audience       string
+	leeway         time.Duration
+	expOptional    bool
+	userNameClaim  string
+	partnerIDClaim string
+	now            func() time.Time
+}
+
+// JWTOption is jwt verifier option.
+type JWTOption func(*JWTVerifier)
+
+// WithJWTAlgs with the accepted algorithms, HS256, RS256 and ES256 by default.
+func WithJWTAlgs(algs ...string) JWTOption {
+	return func(v *JWTVerifier) {
+		v.algs = algs
+	}
+}
+
+// WithIssuer with the required iss claim.
+func WithIssuer(issuer string) JWTOption {
+	return func(v *JWTVerifier) {
+		v.issuer = issuer
+	}
+}
+
+// WithAudience with the audience which must be in the aud claim.
+func WithAudience(audience string) JWTOption {
+	return func(v *JWTVerifier) {
+		v.audience = audience
+	}
+}
+
+// WithLeeway with the accepted clock difference of the exp and nbf claims, DefaultLeeway by default.
+func WithLeeway(leeway time.Duration) JWTOption {
+	return func(v *JWTVerifier) {
+		v.leeway = leeway
+	}
+}
+
+// WithExpOptional accepts the tokens without an exp claim, which never expire,
+// only use it for an issuer which cannot set exp. The exp claim is required by default.
+func WithExpOptional() JWTOption {
+	return func(v *JWTVerifier) {
+		v.expOptional = true
+	}
+}
+
+// WithClaimKeys with the claims mapped into ContextKeyUserName and ContextKeyPartnerId,
+// "sub" and "partner_id" by default, an empty name is not mapped.
+func WithClaimKeys(userName, partnerID string) JWTOption {
+	return func(v *JWTVerifier) {
+		v.userNameClaim = userName
+		v.partnerIDClaim = partnerID
+	}
+}
+
+// NewJWTVerifier news a verifier of the tokens signed with the keys of the source.
+func NewJWTVerifier(keys KeySource, opts ...JWTOption) *JWTVerifier {
+	v := &JWTVerifier{
+		keys:           keys,
+		algs:           []string{AlgHS256, AlgRS256, AlgES256},
+		leeway:         DefaultLeeway,
+		userNameClaim:  "sub",
+		partnerIDClaim: "partner_id",
+		now:            time.Now,
+	}
+	for _, o := range opts {
+		o(v)
+	}
+	return v
+}
+
+// Verify verifies the token and returns its claims. It returns ErrSignatureError
+// for an invalid token, including one without exp unless WithExpOptional, and
+// ErrExpiredSignature for an expired one.
+func (v *JWTVerifier) Verify(ctx context.Context, token string) (Claims, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, invalidToken("malformed")
+	}
+	var header struct {
+		Alg string `json:"alg"`
+		Kid string `json:"kid"`
+	}
+	if err := decodeSegment(parts[0], &header); err != nil {
+		return nil, invalidToken("malformed header")
+	}
+	if !v.allowed(header.Alg) {
+		return nil, invalidToken("alg " + header.Alg + " not allowed")
+	}
+	sig, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, invalidToken("malformed signature")
+	}
+	key, err := v.keys.Key(ctx, header.Kid, header.Alg)
+	if err != nil {
+		return nil, err
+	}
+	if !verifyJWS(header.Alg, key, []byte(parts[0]+"."+parts[1]), sig) {
+		return nil, invalidToken("bad signature")
+	}
+
+	var claims Claims
+	if err := decodeSegment(parts[1], &claims); err != nil {
+		return nil, invalidToken("malformed claims")
+	}
+	now := v.now()
+	exp, ok, err := claims.time("exp")
+	if err != nil {
+		return nil, err
+	}
+	if !ok && !v.expOptional {
+		return nil, invalidToken("missing exp claim")
+	}
+	if ok && !now.Before(exp.Add(v.leeway)) {
+		return nil, errorutil.ErrExpiredSignature.WithMessage("token expired")
+	}
+	nbf, ok, err := claims.time("nbf")
+	if err != nil {
+		return nil, err
+	}
+	if ok && now.Add(v.leeway).Before(nbf) {
+		return nil, invalidToken("token not valid yet")
+	}
+	if v.issuer != "" && claims.String("iss") != v.issuer {
+		return nil, invalidToken("bad issuer")
+	}
+	if v.audience != "" && !contains(claims.Audience(), v.audience) {
+		return nil, invalidToken("bad audience")
+	}
+	return claims, nil
+}
+
+// NewContext returns a new Context that carries the claims, with the user name and partner id
+// claims in ContextKeyUserName and ContextKeyPartnerId.
+func (v *JWTVerifier) NewContext(ctx context.Context, claims Claims) context.Context {
+	ctx = NewClaimsContext(ctx, claims)
+	if name := claims.String(v.userNameClaim); v.userNameClaim != "" && name != "" {
+		ctx = context.WithValue(ctx, ContextKeyUserName, name)
+	}
+	if id := claims.String(v.partnerIDClaim); v.partnerIDClaim != "" && id != "" {
+		ctx = context.WithValue(ctx, ContextKeyPartnerId, id)
+	}
+	return ctx
+}
+
+// BearerToken returns the token of an Authorization header value "Bearer <token>".
+func BearerToken(authorization string) (string, bool) {
+	const prefix = "bearer "
+	if len(authorization) <= len(prefix) || !strings.EqualFold(authorization[:len(prefix)], prefix) {
+		return "", false
+	}
+	return strings.TrimSpace(authorization[len(prefix):]), true
+}
+
+func (v *JWTVerifier) allowed(alg string) bool {
+	for _, a := range v.algs {
+		if a == alg {
+			return true
+		}
+	}
+	return false
+}
+
+func verifyJWS(alg string, key interface{}, signed, sig []byte) bool {
+	digest := sha256.Sum256(signed)
+	switch alg {
+	case AlgHS256:
+		secret, ok := key.([]byte)
+		if !ok {
+			return false
+		}
+		mac := hmac.New(sha256.New, secret)
+		mac.Write(signed)
+		return hmac.Equal(sig, mac.Sum(nil))
+	case AlgRS256:
+		pub, ok := key.(*rsa.PublicKey)
+		return ok && rsa.VerifyPKCS1v15(pub, crypto.SHA256, digest[:], sig) == nil
+	case AlgES256:
+		pub, ok := key.(*ecdsa.PublicKey)
+		if !ok || len(sig) != 64 {
+			return false
+		}
+		r, s := new(big.Int).SetBytes(sig[:32]), new(big.Int).SetBytes(sig[32:])
+		return ecdsa.Verify(pub, digest[:], r, s)
+	}
+	return false
+}
+
+func decodeSegment(seg string, v interface{}) error {
+	data, err := base64.RawURLEncoding.DecodeString(seg)
+	if err != nil {
+		return err
+	}
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	return dec.Decode(v)
+}
+
+func invalidToken(reason string) error {
+	return errorutil.ErrSignatureError.WithMessage("invalid token: " + reason)
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
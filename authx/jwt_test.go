@@ -0,0 +1,277 @@
+package authutil
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	errorutil "github.com/XuThreeFire/goutil/errorx"
+)
+
+func signJWT(t *testing.T, alg, kid string, key interface{}, claims map[string]interface{}) string {
+	t.Helper()
+	header, _ := json.Marshal(map[string]string{"alg": alg, "kid": kid, "typ": "JWT"})
+	payload, _ := json.Marshal(claims)
+	signed := base64.RawURLEncoding.EncodeToString(header) + "." + base64.RawURLEncoding.EncodeToString(payload)
+	digest := sha256.Sum256([]byte(signed))
+	var sig []byte
+	switch k := key.(type) {
+	case []byte:
+		mac := hmac.New(sha256.New, k)
+		mac.Write([]byte(signed))
+		sig = mac.Sum(nil)
+	case *rsa.PrivateKey:
+		sig, _ = rsa.SignPKCS1v15(rand.Reader, k, crypto.SHA256, digest[:])
+	case *ecdsa.PrivateKey:
+		r, s, _ := ecdsa.Sign(rand.Reader, k, digest[:])
+		sig = make([]byte, 64)
+		r.FillBytes(sig[:32])
+		s.FillBytes(sig[32:])
+	}
+	return signed + "." + base64.RawURLEncoding.EncodeToString(sig)
+}
+
+func TestJWTVerifier(t *testing.T) {
+	ctx := context.Background()
+	rsaKey, _ := rsa.GenerateKey(rand.Reader, 2048)
+	ecKey, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	exp := time.Now().Add(time.Hour).Unix()
+	claims := map[string]interface{}{"sub": "alice", "partner_id": 42, "iss": "idp", "aud": []string{"api"}, "exp": exp}
+
+	tests := []struct {
+		name  string
+		alg   string
+		sign  interface{}
+		key   interface{}
+		want  *errorutil.Error
+		token string
+	}{
+		{name: "HS256", alg: AlgHS256, sign: []byte("secret"), key: []byte("secret")},
+		{name: "RS256", alg: AlgRS256, sign: rsaKey, key: &rsaKey.PublicKey},
+		{name: "ES256", alg: AlgES256, sign: ecKey, key: &ecKey.PublicKey},
+		{name: "bad key", alg: AlgHS256, sign: []byte("other"), key: []byte("secret"), want: errorutil.ErrSignatureError},
+		{name: "alg confusion", alg: AlgHS256, sign: []byte("secret"), key: &rsaKey.PublicKey, want: errorutil.ErrSignatureError},
+		{name: "none", key: []byte("secret"), want: errorutil.ErrSignatureError,
+			token: base64.RawURLEncoding.EncodeToString([]byte(`{"alg":"none"}`)) + ".e30."},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			token := tt.token
+			if token == "" {
+				token = signJWT(t, tt.alg, "", tt.sign, claims)
+			}
+			v := NewJWTVerifier(StaticKey(tt.key), WithIssuer("idp"), WithAudience("api"))
+			got, err := v.Verify(ctx, token)
+			if tt.want != nil {
+				if !tt.want.Is(err) {
+					t.Errorf("Verify() = %v, want %v", err, tt.want)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Verify() = %v", err)
+			}
+			ctx := v.NewContext(ctx, got)
+			if ctx.Value(ContextKeyUserName) != "alice" || ctx.Value(ContextKeyPartnerId) != "42" {
+				t.Errorf("NewContext() user = %v, partner = %v", ctx.Value(ContextKeyUserName), ctx.Value(ContextKeyPartnerId))
+			}
+		})
+	}
+
+	key := []byte("secret")
+	expired := signJWT(t, AlgHS256, "", key, map[string]interface{}{"exp": time.Now().Add(-time.Minute).Unix()})
+	if _, err := NewJWTVerifier(StaticKey(key)).Verify(ctx, expired); !errorutil.ErrExpiredSignature.Is(err) {
+		t.Errorf("Verify() expired = %v", err)
+	}
+	for _, claim := range []string{"exp", "nbf"} {
+		bad := signJWT(t, AlgHS256, "", key, map[string]interface{}{"exp": exp, claim: "tomorrow"})
+		if _, err := NewJWTVerifier(StaticKey(key)).Verify(ctx, bad); !errorutil.ErrSignatureError.Is(err) {
+			t.Errorf("Verify() non-numeric %s = %v", claim, err)
+		}
+	}
+	noExp := signJWT(t, AlgHS256, "", key, map[string]interface{}{"sub": "alice"})
+	if _, err := NewJWTVerifier(StaticKey(key)).Verify(ctx, noExp); !errorutil.ErrSignatureError.Is(err) {
+		t.Errorf("Verify() without exp = %v", err)
+	}
+	if _, err := NewJWTVerifier(StaticKey(key), WithExpOptional()).Verify(ctx, noExp); err != nil {
+		t.Errorf("Verify() without exp WithExpOptional = %v", err)
+	}
+	wrongAud := signJWT(t, AlgHS256, "", key, map[string]interface{}{"aud": "other", "exp": exp})
+	if _, err := NewJWTVerifier(StaticKey(key), WithAudience("api")).Verify(ctx, wrongAud); !errorutil.ErrSignatureError.Is(err) {
+		t.Errorf("Verify() wrong audience = %v", err)
+	}
+	if _, err := NewJWTVerifier(StaticKey(key), WithJWTAlgs(AlgRS256)).Verify(ctx, wrongAud); !errorutil.ErrSignatureError.Is(err) {
+		t.Errorf("Verify() alg not allowed = %v", err)
+	}
+
+	for in, want := range map[string]string{"Bearer abc": "abc", "bearer  abc": "abc", "Basic abc": "", "Bearer ": ""} {
+		if got, _ := BearerToken(in); got != want {
+			t.Errorf("BearerToken(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
+
+func jwksJSON(kids map[string]*ecdsa.PublicKey) []byte {
+	var keys []map[string]string
+	for kid, pub := range kids {
+		keys = append(keys, map[string]string{
+			"kty": "EC", "crv": "P-256", "kid": kid, "use": "sig",
+			"x": base64.RawURLEncoding.EncodeToString(pub.X.FillBytes(make([]byte, 32))),
+			"y": base64.RawURLEncoding.EncodeToString(pub.Y.FillBytes(make([]byte, 32))),
+		})
+	}
+	data, _ := json.Marshal(map[string]interface{}{"keys": keys})
+	return data
+}
+
+func TestJWKS(t *testing.T) {
+	ctx := context.Background()
+	exp := time.Now().Add(time.Hour).Unix()
+	k1, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	k2, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	rsaKey, _ := rsa.GenerateKey(rand.Reader, 2048)
+
+	path := filepath.Join(t.TempDir(), "jwks.json")
+	rsaJWKS := fmt.Sprintf(`{"keys":[{"kty":"RSA","kid":"r1","n":%q,"e":%q}]}`,
+		base64.RawURLEncoding.EncodeToString(rsaKey.N.Bytes()),
+		base64.RawURLEncoding.EncodeToString(big.NewInt(int64(rsaKey.E)).Bytes()))
+	if err := os.WriteFile(path, []byte(rsaJWKS), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	v := NewJWTVerifier(NewJWKS(path))
+	if _, err := v.Verify(ctx, signJWT(t, AlgRS256, "r1", rsaKey, map[string]interface{}{"sub": "a", "exp": exp})); err != nil {
+		t.Errorf("Verify() with file jwks = %v", err)
+	}
+
+	var (
+		fetches int32
+		body    atomic.Value
+	)
+	body.Store(jwksJSON(map[string]*ecdsa.PublicKey{"k1": &k1.PublicKey}))
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&fetches, 1)
+		w.Write(body.Load().([]byte))
+	}))
+	defer srv.Close()
+
+	jwks := NewJWKS(srv.URL, WithJWKSMinRefresh(time.Minute))
+	now := time.Now()
+	jwks.now = func() time.Time { return now }
+	v = NewJWTVerifier(jwks)
+	for i := 0; i < 2; i++ {
+		if _, err := v.Verify(ctx, signJWT(t, AlgES256, "k1", k1, map[string]interface{}{"sub": "a", "exp": exp})); err != nil {
+			t.Fatalf("Verify() with url jwks = %v", err)
+		}
+	}
+	if atomic.LoadInt32(&fetches) != 1 {
+		t.Errorf("fetches = %d, want the keys cached", atomic.LoadInt32(&fetches))
+	}
+
+	// a rotated key is fetched once the min refresh interval passed
+	body.Store(jwksJSON(map[string]*ecdsa.PublicKey{"k1": &k1.PublicKey, "k2": &k2.PublicKey}))
+	token := signJWT(t, AlgES256, "k2", k2, map[string]interface{}{"sub": "a", "exp": exp})
+	if _, err := v.Verify(ctx, token); !errorutil.ErrSignatureError.Is(err) {
+		t.Errorf("Verify() unknown kid before min refresh = %v", err)
+	}
+	now = now.Add(time.Minute)
+	if _, err := v.Verify(ctx, token); err != nil {
+		t.Errorf("Verify() rotated kid = %v", err)
+	}
+	if atomic.LoadInt32(&fetches) != 2 {
+		t.Errorf("fetches = %d, want 2", atomic.LoadInt32(&fetches))
+	}
+
+	// the concurrent callers share one fetch, made without the lock
+	release := make(chan struct{})
+	slow := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&fetches, 1)
+		<-release
+		w.Write(body.Load().([]byte))
+	}))
+	defer slow.Close()
+	atomic.StoreInt32(&fetches, 0)
+	v = NewJWTVerifier(NewJWKS(slow.URL))
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := v.Verify(ctx, token); err != nil {
+				t.Errorf("Verify() concurrent = %v", err)
+			}
+		}()
+	}
+	time.Sleep(50 * time.Millisecond)
+	close(release)
+	wg.Wait()
+	if atomic.LoadInt32(&fetches) != 1 {
+		t.Errorf("fetches = %d, want 1", atomic.LoadInt32(&fetches))
+	}
+
+	// the caller which started the fetch giving up does not fail the others
+	release = make(chan struct{})
+	atomic.StoreInt32(&fetches, 0)
+	v = NewJWTVerifier(NewJWKS(slow.URL))
+	first, cancel := context.WithCancel(ctx)
+	errs := make(chan error, 2)
+	for _, ctx := range []context.Context{first, ctx} {
+		go func(ctx context.Context) {
+			_, err := v.Verify(ctx, token)
+			errs <- err
+		}(ctx)
+		time.Sleep(20 * time.Millisecond)
+	}
+	cancel()
+	if err := <-errs; !errorutil.ErrInternalError.Is(err) {
+		t.Errorf("Verify() canceled = %v", err)
+	}
+	close(release)
+	if err := <-errs; err != nil {
+		t.Errorf("Verify() waiting for the fetch of a canceled caller = %v", err)
+	}
+}
+
+func TestJWKSOutage(t *testing.T) {
+	ctx := context.Background()
+	var fetches int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&fetches, 1)
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer srv.Close()
+
+	jwks := NewJWKS(srv.URL, WithJWKSMinRefresh(time.Minute))
+	now := time.Now()
+	jwks.now = func() time.Time { return now }
+	// the set never loaded is not fetched again by each request
+	for i := 0; i < 10; i++ {
+		if _, err := jwks.Key(ctx, "k1", AlgES256); !errorutil.ErrInternalError.Is(err) {
+			t.Fatalf("Key() during the outage = %v", err)
+		}
+	}
+	if atomic.LoadInt32(&fetches) != 1 {
+		t.Errorf("fetches = %d, want 1", atomic.LoadInt32(&fetches))
+	}
+	now = now.Add(time.Minute)
+	jwks.Key(ctx, "k1", AlgES256)
+	if atomic.LoadInt32(&fetches) != 2 {
+		t.Errorf("fetches after the min refresh = %d, want 2", atomic.LoadInt32(&fetches))
+	}
+}
@@ -0,0 +1,98 @@
+package authutil
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// KeyProvider returns the active secret keys of an Auth-User.
+// A request is accepted if it is signed with any of them, so a key can be
+// rotated by adding the new key first and removing the old one after a grace period.
+type KeyProvider interface {
+	// Keys returns the active keys of the user, the first one is the primary key
+	// clients sign with. An unknown user has no keys.
+	Keys(ctx context.Context, user string) ([]string, error)
+}
+
+// StaticKeyProvider is a KeyProvider on a map of user to keys.
+type StaticKeyProvider map[string][]string
+
+// Keys returns the keys of the user.
+func (p StaticKeyProvider) Keys(_ context.Context, user string) ([]string, error) {
+	return p[user], nil
+}
+
+// Key is a secret key of a user in a key file.
+type Key struct {
+	Secret string `yaml:"secret" json:"secret"`
+	// ExpiresAt is the end of the grace period of a rotated key, the key never expires if zero.
+	ExpiresAt time.Time `yaml:"expires_at,omitempty" json:"expires_at,omitempty"`
+}
+
+// FileKeyProvider is a KeyProvider on a YAML (or JSON) file of user to keys:
+//
+//	partner-a:
+//	  - secret: new-key
+//	  - secret: old-key
+//	    expires_at: 2022-09-01T00:00:00+08:00
+//
+// The file is reloaded when it changes, a file which fails to load keeps the previous keys.
+type FileKeyProvider struct {
+	w    *fileWatcher
+	mu   sync.RWMutex
+	keys map[string][]Key
+	now  func() time.Time
+}
+
+// FileKeyOption is file key provider option.
+type FileKeyOption = FileOption
+
+// NewFileKeyProvider loads the key file and reloads it every DefaultReloadInterval.
+// Close stops the reload.
+func NewFileKeyProvider(path string, opts ...FileKeyOption) (*FileKeyProvider, error) {
+	p := &FileKeyProvider{now: time.Now}
+	w, err := newFileWatcher(path, p.load, opts)
+	if err != nil {
+		return nil, err
+	}
+	p.w = w
+	return p, nil
+}
+
+// Keys returns the keys of the user which are not expired.
+func (p *FileKeyProvider) Keys(_ context.Context, user string) ([]string, error) {
+	now := p.now()
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	var keys []string
+	for _, k := range p.keys[user] {
+		if k.ExpiresAt.IsZero() || now.Before(k.ExpiresAt) {
+			keys = append(keys, k.Secret)
+		}
+	}
+	return keys, nil
+}
+
+// Reload loads the key file.
+func (p *FileKeyProvider) Reload() error {
+	return p.w.Reload()
+}
+
+// Close stops the reload.
+func (p *FileKeyProvider) Close() error {
+	return p.w.Close()
+}
+
+func (p *FileKeyProvider) load(data []byte) error {
+	var keys map[string][]Key
+	if err := yaml.Unmarshal(data, &keys); err != nil {
+		return err
+	}
+	p.mu.Lock()
+	p.keys = keys
+	p.mu.Unlock()
+	return nil
+}
@@ -0,0 +1,83 @@
+package authutil
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	errorutil "github.com/XuThreeFire/goutil/errorx"
+)
+
+func TestOptionsSignature(t *testing.T) {
+	ctx := context.Background()
+	o := NewOptions(WithKeyProvider(StaticKeyProvider{"user": {"new", "old"}}))
+	signer, _ := GetSigner(AlgHMACSHA256)
+	data := SignData("user", "Query", "1660000000000", "", nil)
+
+	for _, key := range []string{"new", "old"} {
+		want := signer.Sign(data, key)
+		if got, err := o.Signature(ctx, signer, "user", "", want, data); err != nil || got != want {
+			t.Errorf("Signature() with %s key = %s, %v, want %s", key, got, err, want)
+		}
+	}
+	if got, _ := o.Signature(ctx, signer, "user", "", "bad", data); got != signer.Sign(data, "new") {
+		t.Errorf("Signature() with bad signature = %s, want the primary key signature", got)
+	}
+	if _, err := o.Signature(ctx, signer, "other", "", "bad", data); !errorutil.ErrIllegaUser.Is(err) {
+		t.Errorf("Signature() of unknown user err = %v", err)
+	}
+	if key, _ := NewOptions().ClientKey(ctx, "user", "shared"); key != "shared" {
+		t.Errorf("ClientKey() without provider = %s, want shared", key)
+	}
+}
+
+func TestFileKeyProvider(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "keys.yaml")
+	write := func(content string, mod time.Time) {
+		if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.Chtimes(path, mod, mod); err != nil {
+			t.Fatal(err)
+		}
+	}
+	write(`
+partner-a:
+  - secret: new
+  - secret: old
+    expires_at: 2022-09-01T00:00:00Z
+`, time.Now().Add(-time.Minute))
+
+	p, err := NewFileKeyProvider(path, WithReloadInterval(10*time.Millisecond))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer p.Close()
+	p.now = func() time.Time { return time.Date(2022, 8, 1, 0, 0, 0, 0, time.UTC) }
+	if keys, _ := p.Keys(ctx, "partner-a"); !reflect.DeepEqual(keys, []string{"new", "old"}) {
+		t.Errorf("Keys() in grace period = %v", keys)
+	}
+	p.now = func() time.Time { return time.Date(2022, 9, 1, 0, 0, 0, 0, time.UTC) }
+	if keys, _ := p.Keys(ctx, "partner-a"); !reflect.DeepEqual(keys, []string{"new"}) {
+		t.Errorf("Keys() after grace period = %v", keys)
+	}
+
+	write(`{"partner-b": [{"secret": "b"}]}`, time.Now())
+	deadline := time.Now().Add(time.Second)
+	for {
+		if keys, _ := p.Keys(ctx, "partner-b"); reflect.DeepEqual(keys, []string{"b"}) {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("key file not reloaded")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if keys, _ := p.Keys(ctx, "partner-a"); len(keys) != 0 {
+		t.Errorf("Keys() of removed user = %v", keys)
+	}
+}
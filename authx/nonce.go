@@ -0,0 +1,84 @@
+package authutil
+
+import (
+	"container/list"
+	"context"
+	"sync"
+	"time"
+)
+
+// DefaultNonceCapacity is the capacity of the default in-memory nonce store,
+// the nonces of about 400 requests/s over the 4 minutes ttl of the default skew.
+const DefaultNonceCapacity = 100000
+
+// NonceStore records the nonces seen within their ttl,
+// implement it on redis (SET key 1 NX PX ttl) to share nonces between instances.
+type NonceStore interface {
+	// Seen records the key and reports whether it was already recorded within the ttl.
+	Seen(ctx context.Context, key string, ttl time.Duration) (bool, error)
+}
+
+// MemoryNonceStore is an in-memory LRU NonceStore with TTL, the nonces expire in the order
+// they were recorded and the oldest is evicted when it is full.
+type MemoryNonceStore struct {
+	capacity int
+	ll       *list.List
+	items    map[string]*list.Element
+	now      func() time.Time
+	mu       sync.Mutex
+}
+
+type nonceEntry struct {
+	key      string
+	expireAt time.Time
+}
+
+// NewMemoryNonceStore news an in-memory nonce store keeping at most capacity nonces.
+// A nonce evicted before its ttl can be replayed until the timestamp is out of the skew,
+// size it for the peak requests with a nonce of twice the skew window.
+func NewMemoryNonceStore(capacity int) *MemoryNonceStore {
+	if capacity <= 0 {
+		capacity = DefaultNonceCapacity
+	}
+	return &MemoryNonceStore{
+		capacity: capacity,
+		ll:       list.New(),
+		items:    make(map[string]*list.Element),
+		now:      time.Now,
+	}
+}
+
+// Seen records the key and reports whether it was already recorded within the ttl.
+func (s *MemoryNonceStore) Seen(_ context.Context, key string, ttl time.Duration) (bool, error) {
+	now := s.now()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if e, ok := s.items[key]; ok {
+		if now.Before(e.Value.(*nonceEntry).expireAt) {
+			return true, nil
+		}
+		s.remove(e)
+	}
+	// drop the expired nonces at the back
+	for e := s.ll.Back(); e != nil && !now.Before(e.Value.(*nonceEntry).expireAt); e = s.ll.Back() {
+		s.remove(e)
+	}
+	// evict the oldest rather than reject the requests once full
+	for s.ll.Len() >= s.capacity {
+		s.remove(s.ll.Back())
+	}
+	s.items[key] = s.ll.PushFront(&nonceEntry{key: key, expireAt: now.Add(ttl)})
+	return false, nil
+}
+
+// Len returns the number of recorded nonces.
+func (s *MemoryNonceStore) Len() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.ll.Len()
+}
+
+func (s *MemoryNonceStore) remove(e *list.Element) {
+	s.ll.Remove(e)
+	delete(s.items, e.Value.(*nonceEntry).key)
+}
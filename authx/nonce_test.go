@@ -0,0 +1,75 @@
+package authutil
+
+import (
+	"context"
+	"strconv"
+	"testing"
+	"time"
+
+	errorutil "github.com/XuThreeFire/goutil/errorx"
+)
+
+func TestMemoryNonceStore(t *testing.T) {
+	ctx := context.Background()
+	now := time.Unix(1660000000, 0)
+	s := NewMemoryNonceStore(2)
+	s.now = func() time.Time { return now }
+
+	if seen, _ := s.Seen(ctx, "a", time.Minute); seen {
+		t.Fatal("first a seen")
+	}
+	if seen, _ := s.Seen(ctx, "a", time.Minute); !seen {
+		t.Fatal("replayed a not seen")
+	}
+	now = now.Add(time.Second)
+	s.Seen(ctx, "b", time.Minute)
+	// at capacity the oldest a is evicted rather than the request rejected
+	if seen, err := s.Seen(ctx, "c", time.Minute); seen || err != nil {
+		t.Fatalf("Seen() when full = %v, %v", seen, err)
+	}
+	if s.Len() != 2 {
+		t.Fatalf("Len() = %d, want 2", s.Len())
+	}
+	if seen, _ := s.Seen(ctx, "b", time.Minute); !seen {
+		t.Fatal("replayed b not seen when full")
+	}
+	if seen, _ := s.Seen(ctx, "c", time.Minute); !seen {
+		t.Fatal("replayed c not seen when full")
+	}
+
+	now = now.Add(2 * time.Minute)
+	if seen, _ := s.Seen(ctx, "c", time.Minute); seen {
+		t.Fatal("expired c seen")
+	}
+	if s.Len() != 1 {
+		t.Fatalf("Len() = %d, want 1", s.Len())
+	}
+}
+
+func TestOptionsCheck(t *testing.T) {
+	ctx := context.Background()
+	o := NewOptions(WithSkew(time.Minute), WithNonceRequired())
+	if err := o.CheckNonce(ctx, "user", ""); !errorutil.ErrSignatureError.Is(err) {
+		t.Errorf("missing nonce err = %v", err)
+	}
+	if err := o.CheckNonce(ctx, "user", "n1"); err != nil {
+		t.Errorf("first nonce err = %v", err)
+	}
+	if err := o.CheckNonce(ctx, "other", "n1"); err != nil {
+		t.Errorf("other user nonce err = %v", err)
+	}
+	if err := o.CheckNonce(ctx, "user", "n1"); !errorutil.ErrSignatureError.Is(err) {
+		t.Errorf("replayed nonce err = %v", err)
+	}
+
+	if err := o.CheckTimestamp(strconv.FormatInt(time.Now().UnixMilli(), 10)); err != nil {
+		t.Errorf("current timestamp err = %v", err)
+	}
+	old := strconv.FormatInt(time.Now().Add(-2*time.Minute).UnixMilli(), 10)
+	if err := o.CheckTimestamp(old); !errorutil.ErrExpiredSignature.Is(err) {
+		t.Errorf("old timestamp err = %v", err)
+	}
+	if err := NewOptions(WithSkew(0)).CheckTimestamp(old); err != nil {
+		t.Errorf("disabled skew err = %v", err)
+	}
+}
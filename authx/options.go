@@ -0,0 +1,295 @@
+package authutil
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	errorutil "github.com/XuThreeFire/goutil/errorx"
+
+	"github.com/google/uuid"
+)
+
+// Header names of the signature scheme.
+const (
+	HeaderTraceID   = "Trace-Id"
+	HeaderAuthUser  = "Auth-User"
+	HeaderMethod    = "Method"
+	HeaderTimestamp = "Timestamp"
+	HeaderSignature = "Signature"
+	HeaderSignAlg   = "Sign-Alg"
+	HeaderNonce     = "Nonce"
+)
+
+// DefaultSkew is the default accepted difference between the request timestamp and the server time.
+const DefaultSkew = 120 * time.Second
+
+// Option is signature option.
+type Option func(*Options)
+
+// Options is the signature options shared by the server and client middlewares.
+type Options struct {
+	// Alg is the algorithm a client signs with.
+	Alg string
+	// AllowedAlgs is the algorithms a server accepts, all registered signers if empty.
+	AllowedAlgs []string
+	// Nonce makes a client send a signed Nonce header.
+	Nonce bool
+	// NonceRequired makes a server reject requests without a Nonce header.
+	NonceRequired bool
+	// NonceStore records the nonces a server has seen.
+	NonceStore NonceStore
+	// Skew is the accepted timestamp difference, the timestamp is not checked if <= 0.
+	Skew time.Duration
+	// KeyProvider provides the keys of each user, the key of the middleware is used if nil.
+	KeyProvider KeyProvider
+	// TestMode accepts a test signature in staging, disabled if nil.
+	TestMode *TestMode
+	// MaxBodySize is the max size of a body a server buffers for the signature.
+	MaxBodySize int64
+	// MaxHashedBodySize is the max size of a body a server spools in the hash-of-body mode.
+	MaxHashedBodySize int64
+	// BodyHash makes a client sign the sha256 of the body in the Body-Hash header instead of the body.
+	BodyHash bool
+	// SignedPayload signs the gRPC request message as the body.
+	SignedPayload bool
+	// LegacyReply makes a gRPC server return the rejections as the reply with a nil error.
+	LegacyReply bool
+}
+
+// WithAlg with the algorithm a client signs with, e.g. AlgHMACSHA256.
+func WithAlg(alg string) Option {
+	return func(o *Options) {
+		o.Alg = alg
+	}
+}
+
+// WithAllowedAlgs with the algorithms a server accepts,
+// drop AlgMD5 once all callers have migrated.
+func WithAllowedAlgs(algs ...string) Option {
+	return func(o *Options) {
+		o.AllowedAlgs = algs
+	}
+}
+
+// WithNonce makes a client send a signed Nonce header,
+// only enable it for upstreams that support nonces.
+func WithNonce() Option {
+	return func(o *Options) {
+		o.Nonce = true
+	}
+}
+
+// WithNonceRequired makes a server reject requests without a Nonce header.
+func WithNonceRequired() Option {
+	return func(o *Options) {
+		o.NonceRequired = true
+	}
+}
+
+// WithNonceStore with the store of seen nonces, an in-memory LRU by default.
+func WithNonceStore(store NonceStore) Option {
+	return func(o *Options) {
+		o.NonceStore = store
+	}
+}
+
+// WithSkew with the accepted timestamp difference, DefaultSkew by default.
+func WithSkew(skew time.Duration) Option {
+	return func(o *Options) {
+		o.Skew = skew
+	}
+}
+
+// WithKeyProvider with the provider of the per-user keys, a request signed with
+// any active key of its Auth-User is accepted.
+func WithKeyProvider(p KeyProvider) Option {
+	return func(o *Options) {
+		o.KeyProvider = p
+	}
+}
+
+// WithTestMode with the test mode of a server.
+func WithTestMode(t *TestMode) Option {
+	return func(o *Options) {
+		o.TestMode = t
+	}
+}
+
+// WithTestSign with a test mode accepting the legacy testSign of any user from any source,
+// only if the DefaultTestModeEnv environment variable is true.
+//
+// Deprecated: use WithTestMode restricted to the staging users and networks.
+func WithTestSign(testSign string) Option {
+	return func(o *Options) {
+		if testSign != "" {
+			o.TestMode, _ = NewTestMode(testSign)
+		}
+	}
+}
+
+// WithMaxBodySize with the max size of a body a server buffers for the signature, DefaultMaxBodySize by default.
+func WithMaxBodySize(size int64) Option {
+	return func(o *Options) {
+		o.MaxBodySize = size
+	}
+}
+
+// WithMaxHashedBodySize with the max size of a body in the hash-of-body mode, which a server
+// spools to a temporary file rather than memory, DefaultMaxHashedBodySize by default.
+func WithMaxHashedBodySize(size int64) Option {
+	return func(o *Options) {
+		o.MaxHashedBodySize = size
+	}
+}
+
+// WithBodyHash makes a client sign in the hash-of-body mode, for streaming and multipart bodies.
+func WithBodyHash() Option {
+	return func(o *Options) {
+		o.BodyHash = true
+	}
+}
+
+// WithLegacyReply makes a gRPC server return the rejections as the statusCode/statusReason reply
+// with a nil error, for the old clients which decode it instead of the grpc status,
+// an unknown user is returned as the error as it always was.
+// Interceptors and logging see such rejections as successes, migrate the clients and drop it.
+func WithLegacyReply() Option {
+	return func(o *Options) {
+		o.LegacyReply = true
+	}
+}
+
+// NewOptions applies the options.
+func NewOptions(opts ...Option) *Options {
+	o := &Options{
+		Skew:              DefaultSkew,
+		MaxBodySize:       DefaultMaxBodySize,
+		MaxHashedBodySize: DefaultMaxHashedBodySize,
+	}
+	for _, opt := range opts {
+		opt(o)
+	}
+	if o.NonceStore == nil {
+		o.NonceStore = NewMemoryNonceStore(DefaultNonceCapacity)
+	}
+	return o
+}
+
+// Signer returns the signer negotiated by the Sign-Alg header value,
+// ErrSignatureError if the algorithm is unknown or not allowed.
+func (o *Options) Signer(alg string) (Signer, error) {
+	s, ok := GetSigner(alg)
+	if !ok {
+		return nil, errorutil.ErrSignatureError.WithMessage("unsupported Sign-Alg " + alg)
+	}
+	if len(o.AllowedAlgs) == 0 {
+		return s, nil
+	}
+	for _, allowed := range o.AllowedAlgs {
+		if strings.EqualFold(allowed, s.Alg()) {
+			return s, nil
+		}
+	}
+	return nil, errorutil.ErrSignatureError.WithMessage("Sign-Alg " + s.Alg() + " not allowed")
+}
+
+// ClientSigner returns the signer a client signs with, AlgMD5 by default.
+// It panics if the algorithm is not registered.
+func (o *Options) ClientSigner() Signer {
+	s, ok := GetSigner(o.Alg)
+	if !ok {
+		panic("authutil: unsupported Sign-Alg " + o.Alg)
+	}
+	return s
+}
+
+// CheckTimestamp returns ErrExpiredSignature if the millisecond timestamp is out of the skew window.
+func (o *Options) CheckTimestamp(timestamp string) error {
+	if o.Skew <= 0 {
+		return nil
+	}
+	ts, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil {
+		return errorutil.ErrExpiredSignature.WithMessage("invalid timestamp " + timestamp)
+	}
+	diff := time.Since(time.UnixMilli(ts))
+	if diff > o.Skew || diff < -o.Skew {
+		return errorutil.ErrExpiredSignature.WithMessage(fmt.Sprintf("diff=%v", diff.Milliseconds()))
+	}
+	return nil
+}
+
+// CheckNonce returns ErrSignatureError if the nonce of the user was already used
+// within the skew window, or it is missing while required. Check it after the signature.
+func (o *Options) CheckNonce(ctx context.Context, user, nonce string) error {
+	if nonce == "" {
+		if o.NonceRequired {
+			return errorutil.ErrSignatureError.WithMessage("nonce required")
+		}
+		return nil
+	}
+	ttl := 2 * o.Skew
+	if ttl <= 0 {
+		ttl = 2 * DefaultSkew
+	}
+	seen, err := o.NonceStore.Seen(ctx, user+":"+nonce, ttl)
+	if err != nil {
+		return errorutil.ErrInternalError.WithCause(err)
+	}
+	if seen {
+		return errorutil.ErrSignatureError.WithMessage("nonce replayed")
+	}
+	return nil
+}
+
+// Keys returns the keys a request of the user may be signed with,
+// the key if there is no KeyProvider, ErrIllegaUser if the user has no keys.
+func (o *Options) Keys(ctx context.Context, user, key string) ([]string, error) {
+	if o.KeyProvider == nil {
+		return []string{key}, nil
+	}
+	keys, err := o.KeyProvider.Keys(ctx, user)
+	if err != nil {
+		return nil, errorutil.ErrInternalError.WithCause(err)
+	}
+	if len(keys) == 0 {
+		return nil, errorutil.ErrIllegaUser
+	}
+	return keys, nil
+}
+
+// Signature returns the signature of the data with the key of the user matching
+// the request signature, or with the primary key if none matches.
+func (o *Options) Signature(ctx context.Context, signer Signer, user, key, signature string, data []byte) (string, error) {
+	keys, err := o.Keys(ctx, user, key)
+	if err != nil {
+		return "", err
+	}
+	primary := signer.Sign(data, keys[0])
+	if Equal(signature, primary) {
+		return primary, nil
+	}
+	for _, k := range keys[1:] {
+		if sign := signer.Sign(data, k); Equal(signature, sign) {
+			return sign, nil
+		}
+	}
+	return primary, nil
+}
+
+// ClientKey returns the primary key of the user a client signs with, the key if there is no KeyProvider.
+func (o *Options) ClientKey(ctx context.Context, user, key string) (string, error) {
+	keys, err := o.Keys(ctx, user, key)
+	if err != nil {
+		return "", err
+	}
+	return keys[0], nil
+}
+
+// NewNonce returns a random nonce for a client request.
+func NewNonce() string {
+	return strings.ReplaceAll(uuid.NewString(), "-", "")
+}
@@ -0,0 +1,33 @@
+package authutil
+
+import (
+	"fmt"
+
+	errorutil "github.com/XuThreeFire/goutil/errorx"
+
+	"google.golang.org/protobuf/proto"
+)
+
+// WithSignedPayload signs the gRPC request message as the body, so the payload can not be
+// changed in transit. Both the client and the server must enable it.
+func WithSignedPayload() Option {
+	return func(o *Options) {
+		o.SignedPayload = true
+	}
+}
+
+// PayloadBody returns the deterministic protobuf encoding of the gRPC request message,
+// signed as the body with WithSignedPayload. The encoding is only stable between
+// the same message definitions, so both sides must share the proto files.
+// It returns ErrIllegalRequest if req is not a protobuf message.
+func PayloadBody(req interface{}) ([]byte, error) {
+	msg, ok := req.(proto.Message)
+	if !ok {
+		return nil, errorutil.ErrIllegalRequest.WithMessage(fmt.Sprintf("%T is not a protobuf message", req))
+	}
+	body, err := proto.MarshalOptions{Deterministic: true}.Marshal(msg)
+	if err != nil {
+		return nil, errorutil.ErrIllegalRequest.WithCause(err)
+	}
+	return body, nil
+}
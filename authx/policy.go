@@ -0,0 +1,230 @@
+package authutil
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	errorutil "github.com/XuThreeFire/goutil/errorx"
+
+	"github.com/go-kratos/kratos/v2/log"
+	"gopkg.in/yaml.v3"
+)
+
+// Policy maps the users and roles to the operations they may call. An operation is
+// a Kratos operation, e.g. "/api.order.v1.Order/Query", or a go-kit Method name,
+// matched by patterns where "*" matches any characters and "?" one character:
+//
+//	roles:
+//	  reader: ["/api.order.v1.Order/Get*", "/api.order.v1.Order/List*"]
+//	  admin: ["*"]
+//	users:
+//	  partner-a:
+//	    roles: [reader]
+//	    allow: ["/api.order.v1.Order/Create"]
+//
+// The roles of a bearer token come from its "roles" claim as well.
+type Policy struct {
+	Roles map[string][]string   `yaml:"roles" json:"roles"`
+	Users map[string]UserPolicy `yaml:"users" json:"users"`
+}
+
+// UserPolicy is the roles and the operations of a user.
+type UserPolicy struct {
+	Roles []string `yaml:"roles" json:"roles"`
+	Allow []string `yaml:"allow" json:"allow"`
+}
+
+// ParsePolicy parses a YAML (or JSON) policy.
+func ParsePolicy(data []byte) (*Policy, error) {
+	p := new(Policy)
+	if err := yaml.Unmarshal(data, p); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+// Allowed reports whether the user with the roles may call the operation.
+func (p *Policy) Allowed(user string, roles []string, operation string) bool {
+	if p == nil {
+		return false
+	}
+	up := p.Users[user]
+	if matchAny(up.Allow, operation) {
+		return true
+	}
+	for _, list := range [][]string{up.Roles, roles} {
+		for _, role := range list {
+			if matchAny(p.Roles[role], operation) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// Authorizer enforces a Policy, it is safe for concurrent use and its policy can be
+// replaced at run time. In the dry-run mode the denials are only logged.
+type Authorizer struct {
+	denials  uint64 // first for the 64-bit alignment of atomic
+	mu       sync.RWMutex
+	policy   *Policy
+	w        *fileWatcher
+	fileOpts []FileOption
+	dryRun   bool
+	logger   log.Logger
+}
+
+// AuthorizerOption is authorizer option.
+type AuthorizerOption func(*Authorizer)
+
+// WithDryRun only logs the denials and lets the requests through, to try a new policy.
+func WithDryRun() AuthorizerOption {
+	return func(a *Authorizer) {
+		a.dryRun = true
+	}
+}
+
+// WithPolicyLogger with the logger of the denials, the global logger by default.
+func WithPolicyLogger(logger log.Logger) AuthorizerOption {
+	return func(a *Authorizer) {
+		a.logger = logger
+	}
+}
+
+// WithPolicyFileOptions with the reload options of NewFileAuthorizer, e.g. WithReloadInterval.
+func WithPolicyFileOptions(opts ...FileOption) AuthorizerOption {
+	return func(a *Authorizer) {
+		a.fileOpts = append(a.fileOpts, opts...)
+	}
+}
+
+// NewAuthorizer news an authorizer of the policy.
+func NewAuthorizer(policy *Policy, opts ...AuthorizerOption) *Authorizer {
+	a := &Authorizer{policy: policy, logger: log.GetLogger()}
+	for _, o := range opts {
+		o(a)
+	}
+	return a
+}
+
+// NewFileAuthorizer news an authorizer of a policy file reloaded when it changes,
+// a file which fails to load keeps the previous policy. Close stops the reload.
+func NewFileAuthorizer(path string, opts ...AuthorizerOption) (*Authorizer, error) {
+	a := NewAuthorizer(nil, opts...)
+	w, err := newFileWatcher(path, func(data []byte) error {
+		p, err := ParsePolicy(data)
+		if err != nil {
+			return err
+		}
+		a.SetPolicy(p)
+		return nil
+	}, a.fileOpts)
+	if err != nil {
+		return nil, err
+	}
+	a.w = w
+	return a, nil
+}
+
+// SetPolicy replaces the policy.
+func (a *Authorizer) SetPolicy(p *Policy) {
+	a.mu.Lock()
+	a.policy = p
+	a.mu.Unlock()
+}
+
+// Authorize returns ErrIllegalRequest if the user with the roles may not call the operation,
+// nil in the dry-run mode.
+func (a *Authorizer) Authorize(ctx context.Context, user string, roles []string, operation string) error {
+	a.mu.RLock()
+	allowed := a.policy.Allowed(user, roles, operation)
+	a.mu.RUnlock()
+	if allowed {
+		return nil
+	}
+	atomic.AddUint64(&a.denials, 1)
+	log.NewHelper(a.logger).WithContext(ctx).Warnw(
+		"msg", "auth policy denied operation",
+		"user", user,
+		"roles", strings.Join(roles, ","),
+		"operation", operation,
+		"dry_run", a.dryRun,
+	)
+	if a.dryRun {
+		return nil
+	}
+	return errorutil.ErrIllegalRequest.WithMessage(user + " may not call " + operation)
+}
+
+// Denials returns the number of denied requests, including the dry-run ones.
+func (a *Authorizer) Denials() uint64 {
+	return atomic.LoadUint64(&a.denials)
+}
+
+// Close stops the reload of a file authorizer.
+func (a *Authorizer) Close() error {
+	if a.w == nil {
+		return nil
+	}
+	return a.w.Close()
+}
+
+// SubjectFromContext returns the authenticated user and roles of the request: the Auth-User
+// of a signed request, or the user name and "roles" claim of a bearer token.
+func SubjectFromContext(ctx context.Context) (user string, roles []string) {
+	if r, ok := RequestFromContext(ctx); ok {
+		user = r.User
+	} else if name, ok := ctx.Value(ContextKeyUserName).(string); ok {
+		user = name
+	}
+	if claims, ok := ClaimsFromContext(ctx); ok {
+		switch v := claims["roles"].(type) {
+		case string:
+			roles = strings.Fields(v)
+		case []interface{}:
+			for _, role := range v {
+				if s, ok := role.(string); ok {
+					roles = append(roles, s)
+				}
+			}
+		}
+	}
+	return user, roles
+}
+
+func matchAny(patterns []string, s string) bool {
+	for _, p := range patterns {
+		if matchWildcard(p, s) {
+			return true
+		}
+	}
+	return false
+}
+
+// matchWildcard matches s against a pattern where "*" matches any characters and "?" one character.
+func matchWildcard(pattern, s string) bool {
+	// star is the position after the last "*" in pattern, next the position in s it matched up to
+	star, next := -1, 0
+	p, i := 0, 0
+	for i < len(s) {
+		switch {
+		case p < len(pattern) && pattern[p] == '*':
+			star, next = p+1, i
+			p++
+		case p < len(pattern) && (pattern[p] == '?' || pattern[p] == s[i]):
+			p++
+			i++
+		case star >= 0:
+			next++
+			p, i = star, next
+		default:
+			return false
+		}
+	}
+	for p < len(pattern) && pattern[p] == '*' {
+		p++
+	}
+	return p == len(pattern)
+}
@@ -0,0 +1,123 @@
+package authutil
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	errorutil "github.com/XuThreeFire/goutil/errorx"
+	"github.com/go-kratos/kratos/v2/log"
+)
+
+func TestMatchWildcard(t *testing.T) {
+	tests := []struct {
+		pattern, s string
+		want       bool
+	}{
+		{"*", "/api.order.v1.Order/Query", true},
+		{"/api.order.v1.Order/*", "/api.order.v1.Order/Query", true},
+		{"/api.order.v1.Order/Get*", "/api.order.v1.Order/Query", false},
+		{"/api.*.v1.*/List*", "/api.order.v1.Order/ListItems", true},
+		{"Query?", "Query1", true},
+		{"Query?", "Query", false},
+		{"Query", "Query", true},
+		{"", "Query", false},
+		{"*a*b", "xaxxbxb", true},
+	}
+	for _, tt := range tests {
+		if got := matchWildcard(tt.pattern, tt.s); got != tt.want {
+			t.Errorf("matchWildcard(%q, %q) = %v, want %v", tt.pattern, tt.s, got, tt.want)
+		}
+	}
+}
+
+func TestAuthorizer(t *testing.T) {
+	ctx := context.Background()
+	p, err := ParsePolicy([]byte(`
+roles:
+  reader: ["/api.order.v1.Order/Get*"]
+  admin: ["*"]
+users:
+  partner-a:
+    roles: [reader]
+    allow: ["/api.order.v1.Order/Create"]
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	a := NewAuthorizer(p, WithPolicyLogger(log.DefaultLogger))
+	tests := []struct {
+		user      string
+		roles     []string
+		operation string
+		allowed   bool
+	}{
+		{"partner-a", nil, "/api.order.v1.Order/GetOrder", true},
+		{"partner-a", nil, "/api.order.v1.Order/Create", true},
+		{"partner-a", nil, "/api.order.v1.Order/Delete", false},
+		{"partner-b", nil, "/api.order.v1.Order/GetOrder", false},
+		{"partner-b", []string{"admin"}, "/api.order.v1.Order/Delete", true},
+	}
+	for _, tt := range tests {
+		err := a.Authorize(ctx, tt.user, tt.roles, tt.operation)
+		if tt.allowed && err != nil || !tt.allowed && !errorutil.ErrIllegalRequest.Is(err) {
+			t.Errorf("Authorize(%s, %v, %s) = %v, want allowed %v", tt.user, tt.roles, tt.operation, err, tt.allowed)
+		}
+	}
+	if a.Denials() != 2 {
+		t.Errorf("Denials() = %d, want 2", a.Denials())
+	}
+
+	dry := NewAuthorizer(p, WithDryRun(), WithPolicyLogger(log.DefaultLogger))
+	if err := dry.Authorize(ctx, "partner-b", nil, "/api.order.v1.Order/Delete"); err != nil || dry.Denials() != 1 {
+		t.Errorf("Authorize() dry-run = %v, denials %d", err, dry.Denials())
+	}
+
+	claims := Claims{"sub": "bob", "roles": []interface{}{"admin"}}
+	ctx = context.WithValue(NewClaimsContext(ctx, claims), ContextKeyUserName, "bob")
+	if user, roles := SubjectFromContext(ctx); user != "bob" || len(roles) != 1 || roles[0] != "admin" {
+		t.Errorf("SubjectFromContext() = %s, %v", user, roles)
+	}
+	ctx = NewRequestContext(ctx, &Request{User: "partner-a"})
+	if user, _ := SubjectFromContext(ctx); user != "partner-a" {
+		t.Errorf("SubjectFromContext() of signed request = %s", user)
+	}
+}
+
+func TestFileAuthorizer(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "policy.yaml")
+	write := func(content string, mod time.Time) {
+		if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.Chtimes(path, mod, mod); err != nil {
+			t.Fatal(err)
+		}
+	}
+	write(`users: {partner-a: {allow: ["Query"]}}`, time.Now().Add(-time.Minute))
+
+	a, err := NewFileAuthorizer(path, WithPolicyLogger(log.DefaultLogger),
+		WithPolicyFileOptions(WithReloadInterval(10*time.Millisecond)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer a.Close()
+	if err := a.Authorize(ctx, "partner-a", nil, "Query"); err != nil {
+		t.Errorf("Authorize() = %v", err)
+	}
+
+	write(`users: {partner-a: {allow: ["Create"]}}`, time.Now())
+	deadline := time.Now().Add(time.Second)
+	for a.Authorize(ctx, "partner-a", nil, "Create") != nil {
+		if time.Now().After(deadline) {
+			t.Fatal("policy file not reloaded")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if err := a.Authorize(ctx, "partner-a", nil, "Query"); err == nil {
+		t.Error("Authorize() of removed operation = nil")
+	}
+}
@@ -0,0 +1,154 @@
+package authutil
+
+import (
+	"context"
+	"strconv"
+	"time"
+
+	errorutil "github.com/XuThreeFire/goutil/errorx"
+	traceutil "github.com/XuThreeFire/goutil/tracex"
+)
+
+// Request is the signed fields of a request, independent of the transport.
+type Request struct {
+	User      string
+	Method    string
+	Timestamp string
+	Nonce     string
+	Alg       string
+	Signature string
+	Body      []byte
+	// BodyHash is the lower hex sha256 of the body signed instead of the body in the
+	// hash-of-body mode, the body is still checked against it by Verify.
+	BodyHash string
+	// Addr is the source address of a server request, checked by the test mode.
+	Addr string
+
+	// bodyChecked is set by ReadBody once the body matched BodyHash while it was read.
+	bodyChecked bool
+}
+
+// RequestFromHeader reads the signed fields from the headers, get is e.g. http.Header.Get.
+func RequestFromHeader(get func(key string) string) *Request {
+	return &Request{
+		User:      get(HeaderAuthUser),
+		Method:    get(HeaderMethod),
+		Timestamp: get(HeaderTimestamp),
+		Nonce:     get(HeaderNonce),
+		Alg:       get(HeaderSignAlg),
+		Signature: get(HeaderSignature),
+	}
+}
+
+// SetHeader writes the signed fields to the headers, set is e.g. http.Header.Set.
+// Sign-Alg is only set if it is not the legacy md5 and Nonce if not empty.
+func (r *Request) SetHeader(set func(key, value string)) {
+	set(HeaderAuthUser, r.User)
+	set(HeaderMethod, r.Method)
+	set(HeaderTimestamp, r.Timestamp)
+	set(HeaderSignature, r.Signature)
+	if r.Alg != "" && r.Alg != AlgMD5 {
+		set(HeaderSignAlg, r.Alg)
+	}
+	if r.Nonce != "" {
+		set(HeaderNonce, r.Nonce)
+	}
+	if r.BodyHash != "" {
+		set(HeaderBodyHash, r.BodyHash)
+	}
+}
+
+// Data returns the data the request is signed on, the body hash instead of the body if set.
+// The v2 algorithms sign SignDataV2, the others SignData with the body hash after a
+// "Body-Hash:" marker, so a request signed on its body is not valid in the other mode.
+func (r *Request) Data() []byte {
+	if s, ok := GetSigner(r.Alg); ok && SignVersion(s) == 2 {
+		if r.BodyHash != "" {
+			return SignDataV2(r.User, r.Method, r.Timestamp, r.Nonce, BodyModeSHA256, []byte(r.BodyHash))
+		}
+		return SignDataV2(r.User, r.Method, r.Timestamp, r.Nonce, BodyModeRaw, r.Body)
+	}
+	if r.BodyHash != "" {
+		return SignData(r.User, r.Method, r.Timestamp, r.Nonce, []byte(HeaderBodyHash+":"+r.BodyHash))
+	}
+	return SignData(r.User, r.Method, r.Timestamp, r.Nonce, r.Body)
+}
+
+// Verify verifies a server request signed with the key, or any active key of its user
+// with a KeyProvider. A signed request is then checked against the timestamp skew
+// window and nonce replays, a request of the test mode is not.
+// It returns ErrSignatureError if the signature does not match, or in the hash-of-body
+// mode if r.Body does not match the hash, unless ReadBody checked it while reading it.
+func (o *Options) Verify(ctx context.Context, r *Request, key string) error {
+	if err := r.checkBodyHash(); err != nil {
+		return err
+	}
+	signer, err := o.Signer(r.Alg)
+	if err != nil {
+		return err
+	}
+	sign, err := o.Signature(ctx, signer, r.User, key, r.Signature, r.Data())
+	if err != nil {
+		return err
+	}
+	if !Equal(r.Signature, sign) {
+		if o.TestMode.Allow(ctx, r.User, r.Addr, r.Signature) {
+			return nil
+		}
+		return errorutil.ErrSignatureError
+	}
+	if err := o.CheckTimestamp(r.Timestamp); err != nil {
+		return err
+	}
+	return o.CheckNonce(ctx, r.User, r.Nonce)
+}
+
+// Sign signs a client request with the client algorithm and the key, or the primary key
+// of its user with a KeyProvider. The timestamp is set to now if empty,
+// a nonce is added with WithNonce, the body hash with WithBodyHash unless it is already set.
+func (o *Options) Sign(ctx context.Context, r *Request, key string) error {
+	key, err := o.ClientKey(ctx, r.User, key)
+	if err != nil {
+		return err
+	}
+	signer := o.ClientSigner()
+	r.Alg = signer.Alg()
+	if r.Timestamp == "" {
+		r.Timestamp = strconv.FormatInt(time.Now().UnixMilli(), 10)
+	}
+	r.Nonce = ""
+	if o.Nonce {
+		r.Nonce = NewNonce()
+	}
+	if o.BodyHash && r.BodyHash == "" {
+		r.BodyHash = BodyHash(r.Body)
+	}
+	r.Signature = signer.Sign(r.Data(), key)
+	return nil
+}
+
+// TraceIDKey is the context key of the trace id shared by the kratos and go-kit middlewares.
+type TraceIDKey = traceutil.TraceIDKey
+
+// NewTraceContext returns a new Context that carries the trace id, see traceutil.NewTraceContext.
+func NewTraceContext(ctx context.Context, traceID string) context.Context {
+	return traceutil.NewTraceContext(ctx, traceID)
+}
+
+// TraceIDFromContext returns the trace id in ctx if any, see traceutil.TraceIDFromContext.
+func TraceIDFromContext(ctx context.Context) (string, bool) {
+	return traceutil.TraceIDFromContext(ctx)
+}
+
+type requestKey struct{}
+
+// NewRequestContext returns a new Context that carries the signed request.
+func NewRequestContext(ctx context.Context, r *Request) context.Context {
+	return context.WithValue(ctx, requestKey{}, r)
+}
+
+// RequestFromContext returns the signed request in ctx if any.
+func RequestFromContext(ctx context.Context) (*Request, bool) {
+	r, ok := ctx.Value(requestKey{}).(*Request)
+	return r, ok
+}
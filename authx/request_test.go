@@ -0,0 +1,59 @@
+package authutil
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"testing"
+	"time"
+
+	errorutil "github.com/XuThreeFire/goutil/errorx"
+)
+
+func TestSignVerify(t *testing.T) {
+	ctx := context.Background()
+	client := NewOptions(WithAlg(AlgHMACSHA256), WithNonce())
+	server := NewOptions(WithNonceRequired())
+
+	r := &Request{User: "user", Method: "Query", Body: []byte(`{"id":1}`)}
+	if err := client.Sign(ctx, r, "key"); err != nil {
+		t.Fatal(err)
+	}
+	header := http.Header{}
+	r.SetHeader(header.Set)
+	if header.Get(HeaderSignAlg) != AlgHMACSHA256 || header.Get(HeaderNonce) == "" {
+		t.Fatalf("SetHeader() = %v", header)
+	}
+
+	got := RequestFromHeader(header.Get)
+	got.Body = r.Body
+	if err := server.Verify(ctx, got, "key"); err != nil {
+		t.Fatalf("Verify() = %v", err)
+	}
+	if err := server.Verify(ctx, got, "key"); !errorutil.ErrSignatureError.Is(err) {
+		t.Errorf("Verify() replayed = %v", err)
+	}
+
+	got.Body = []byte(`{"id":2}`)
+	if err := server.Verify(ctx, got, "key"); err != errorutil.ErrSignatureError {
+		t.Errorf("Verify() tampered = %v", err)
+	}
+
+	old := &Request{User: "user", Method: "Query", Timestamp: strconv.FormatInt(time.Now().Add(-time.Hour).UnixMilli(), 10)}
+	if err := NewOptions().Sign(ctx, old, "key"); err != nil {
+		t.Fatal(err)
+	}
+	if err := NewOptions().Verify(ctx, old, "key"); !errorutil.ErrExpiredSignature.Is(err) {
+		t.Errorf("Verify() expired = %v", err)
+	}
+}
+
+func TestTraceContext(t *testing.T) {
+	ctx := context.Background()
+	if _, ok := TraceIDFromContext(ctx); ok {
+		t.Error("empty context has a trace id")
+	}
+	if traceID, _ := TraceIDFromContext(NewTraceContext(ctx, "abc")); traceID != "abc" {
+		t.Errorf("TraceIDFromContext() = %s, want abc", traceID)
+	}
+}
@@ -0,0 +1,70 @@
+package authutil
+
+import (
+	"crypto/hmac"
+	"crypto/md5"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/hex"
+	"testing"
+)
+
+func TestSigner(t *testing.T) {
+	data := SignData("user", "Query", "1660000000000", "", []byte(`{"id":1}`))
+	legacy := md5.Sum([]byte(`userQuery1660000000000{"id":1}key`))
+	mac256 := hmac.New(sha256.New, []byte("key"))
+	mac256.Write(data)
+	mac512 := hmac.New(sha512.New, []byte("key"))
+	mac512.Write(data)
+	tests := []struct {
+		alg  string
+		want string
+	}{
+		{"", hex.EncodeToString(legacy[:])},
+		{AlgHMACSHA256, hex.EncodeToString(mac256.Sum(nil))},
+		{"HMAC-SHA512", hex.EncodeToString(mac512.Sum(nil))},
+	}
+	for _, tt := range tests {
+		s, ok := GetSigner(tt.alg)
+		if !ok {
+			t.Fatalf("GetSigner(%q) not found", tt.alg)
+		}
+		if got := s.Sign(data, "key"); got != tt.want {
+			t.Errorf("%s Sign() = %s, want %s", s.Alg(), got, tt.want)
+		}
+	}
+}
+
+func TestOptionsSigner(t *testing.T) {
+	o := NewOptions(WithAllowedAlgs(AlgHMACSHA256))
+	if _, err := o.Signer(AlgHMACSHA256); err != nil {
+		t.Errorf("Signer(hmac-sha256) = %v", err)
+	}
+	if _, err := o.Signer(""); err == nil {
+		t.Error("Signer(md5) must be rejected")
+	}
+	if _, err := NewOptions().Signer("sha1"); err == nil {
+		t.Error("Signer(sha1) must be rejected")
+	}
+}
+
+func TestSignDataV2(t *testing.T) {
+	data := SignDataV2("user", "Query", "1660000000000", "n1", BodyModeRaw, []byte(`{"id":1}`))
+	if want := `2:v2,4:user,5:Query,13:1660000000000,2:n1,4:body,8:{"id":1},`; string(data) != want {
+		t.Errorf("SignDataV2() = %s, want %s", data, want)
+	}
+	// the legacy data cannot tell the nonce from the start of the body
+	shifted := SignDataV2("user", "Query", "1660000000000", `n1{"id"`, BodyModeRaw, []byte(`:1}`))
+	if string(shifted) == string(data) {
+		t.Error("SignDataV2() shifted fields sign the same data")
+	}
+
+	r := &Request{User: "user", Method: "Query", Timestamp: "1660000000000", Nonce: "n1", Alg: AlgHMACSHA256V2, Body: []byte(`{"id":1}`)}
+	if string(r.Data()) != string(data) {
+		t.Errorf("Data() = %s, want the v2 data", r.Data())
+	}
+	r.Alg = AlgHMACSHA256
+	if string(r.Data()) != `userQuery1660000000000n1{"id":1}` {
+		t.Errorf("Data() = %s, want the legacy data", r.Data())
+	}
+}
@@ -0,0 +1,141 @@
+package authutil
+
+import (
+	"context"
+	"net"
+	"os"
+	"strconv"
+	"sync/atomic"
+
+	"github.com/go-kratos/kratos/v2/log"
+)
+
+// DefaultTestModeEnv is the environment variable which must be true to enable the test mode.
+const DefaultTestModeEnv = "AUTH_TEST_MODE"
+
+// TestMode accepts a fixed test signature instead of the real one, for staging only.
+// It is disabled unless its environment variable is true, and can be restricted
+// to some users and source networks. Every bypass is logged as a warning and counted.
+type TestMode struct {
+	bypasses  uint64 // first for the 64-bit alignment of atomic
+	signature string
+	env       string
+	users     map[string]struct{}
+	nets      []*net.IPNet
+	logger    log.Logger
+	enabled   bool
+}
+
+// TestModeOption is test mode option.
+type TestModeOption func(*TestMode) error
+
+// WithTestEnv with the environment variable enabling the test mode, DefaultTestModeEnv by default.
+func WithTestEnv(env string) TestModeOption {
+	return func(t *TestMode) error {
+		t.env = env
+		return nil
+	}
+}
+
+// WithTestUsers with the users allowed to bypass, all users if not set.
+func WithTestUsers(users ...string) TestModeOption {
+	return func(t *TestMode) error {
+		t.users = make(map[string]struct{}, len(users))
+		for _, user := range users {
+			t.users[user] = struct{}{}
+		}
+		return nil
+	}
+}
+
+// WithTestCIDRs with the source networks allowed to bypass, e.g. "10.0.0.0/8", all sources if not set.
+func WithTestCIDRs(cidrs ...string) TestModeOption {
+	return func(t *TestMode) error {
+		for _, cidr := range cidrs {
+			_, n, err := net.ParseCIDR(cidr)
+			if err != nil {
+				return err
+			}
+			t.nets = append(t.nets, n)
+		}
+		return nil
+	}
+}
+
+// WithTestLogger with the logger of the bypass warnings, the global logger by default.
+func WithTestLogger(logger log.Logger) TestModeOption {
+	return func(t *TestMode) error {
+		t.logger = logger
+		return nil
+	}
+}
+
+// NewTestMode news a test mode accepting the signature, the environment variable
+// is read once here.
+func NewTestMode(signature string, opts ...TestModeOption) (*TestMode, error) {
+	t := &TestMode{
+		signature: signature,
+		env:       DefaultTestModeEnv,
+		logger:    log.GetLogger(),
+	}
+	for _, o := range opts {
+		if err := o(t); err != nil {
+			return nil, err
+		}
+	}
+	t.enabled, _ = strconv.ParseBool(os.Getenv(t.env))
+	t.enabled = t.enabled && signature != ""
+	return t, nil
+}
+
+// Enabled reports whether the test mode is enabled by its environment variable.
+func (t *TestMode) Enabled() bool {
+	return t != nil && t.enabled
+}
+
+// Allow reports whether the request of the user from addr ("host" or "host:port")
+// with the signature bypasses the signature check, and logs the bypass.
+func (t *TestMode) Allow(ctx context.Context, user, addr, signature string) bool {
+	if !t.Enabled() || !Equal(signature, t.signature) {
+		return false
+	}
+	if t.users != nil {
+		if _, ok := t.users[user]; !ok {
+			return false
+		}
+	}
+	if len(t.nets) > 0 && !t.containsAddr(addr) {
+		return false
+	}
+	atomic.AddUint64(&t.bypasses, 1)
+	log.NewHelper(t.logger).WithContext(ctx).Warnw(
+		"msg", "auth test mode bypassed signature check",
+		"user", user,
+		"addr", addr,
+	)
+	return true
+}
+
+// Bypasses returns the number of requests which bypassed the signature check.
+func (t *TestMode) Bypasses() uint64 {
+	if t == nil {
+		return 0
+	}
+	return atomic.LoadUint64(&t.bypasses)
+}
+
+func (t *TestMode) containsAddr(addr string) bool {
+	if host, _, err := net.SplitHostPort(addr); err == nil {
+		addr = host
+	}
+	ip := net.ParseIP(addr)
+	if ip == nil {
+		return false
+	}
+	for _, n := range t.nets {
+		if n.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,52 @@
+package authutil
+
+import (
+	"context"
+	"testing"
+)
+
+func TestTestMode(t *testing.T) {
+	ctx := context.Background()
+	t.Setenv(DefaultTestModeEnv, "")
+	disabled, _ := NewTestMode("test")
+	if disabled.Allow(ctx, "user", "10.0.0.1:80", "test") {
+		t.Error("disabled test mode allowed")
+	}
+
+	t.Setenv(DefaultTestModeEnv, "true")
+	tm, err := NewTestMode("test", WithTestUsers("user"), WithTestCIDRs("10.0.0.0/8", "::1/128"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		user, addr, signature string
+		want                  bool
+	}{
+		{"user", "10.0.0.1:80", "test", true},
+		{"user", "[::1]:80", "TEST", true},
+		{"user", "10.0.0.1", "test", true},
+		{"user", "192.168.0.1:80", "test", false},
+		{"other", "10.0.0.1:80", "test", false},
+		{"user", "10.0.0.1:80", "bad", false},
+		{"user", "", "test", false},
+	}
+	for _, tt := range tests {
+		if got := tm.Allow(ctx, tt.user, tt.addr, tt.signature); got != tt.want {
+			t.Errorf("Allow(%s, %s, %s) = %v, want %v", tt.user, tt.addr, tt.signature, got, tt.want)
+		}
+	}
+	if tm.Bypasses() != 3 {
+		t.Errorf("Bypasses() = %d, want 3", tm.Bypasses())
+	}
+
+	if _, err := NewTestMode("test", WithTestCIDRs("10.0.0.1")); err == nil {
+		t.Error("invalid cidr accepted")
+	}
+	if o := NewOptions(WithTestSign("test")); !o.TestMode.Allow(ctx, "any", "1.2.3.4:5", "test") {
+		t.Error("legacy testSign not allowed in test mode")
+	}
+	var none *TestMode
+	if none.Allow(ctx, "user", "10.0.0.1:80", "") || none.Bypasses() != 0 {
+		t.Error("nil test mode allowed")
+	}
+}
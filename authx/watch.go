@@ -0,0 +1,112 @@
+package authutil
+
+import (
+	"os"
+	"sync"
+	"time"
+)
+
+// DefaultReloadInterval is the default interval a file is checked for changes.
+const DefaultReloadInterval = 10 * time.Second
+
+// FileOption is the option of the files reloaded when they change.
+type FileOption func(*fileWatcher)
+
+// WithReloadInterval with the interval the file is checked for changes, reload is disabled if <= 0.
+func WithReloadInterval(interval time.Duration) FileOption {
+	return func(w *fileWatcher) {
+		w.interval = interval
+	}
+}
+
+// WithReloadError with the handler of the errors of a reload.
+func WithReloadError(f func(error)) FileOption {
+	return func(w *fileWatcher) {
+		w.onError = f
+	}
+}
+
+// fileWatcher loads a file and reloads it when its mod time changes,
+// a file which fails to load keeps the previous content.
+type fileWatcher struct {
+	path     string
+	interval time.Duration
+	onError  func(error)
+	load     func(data []byte) error
+
+	mu      sync.Mutex
+	modTime time.Time
+	done    chan struct{}
+	once    sync.Once
+}
+
+func newFileWatcher(path string, load func(data []byte) error, opts []FileOption) (*fileWatcher, error) {
+	w := &fileWatcher{
+		path:     path,
+		interval: DefaultReloadInterval,
+		onError:  func(error) {},
+		load:     load,
+		done:     make(chan struct{}),
+	}
+	for _, o := range opts {
+		o(w)
+	}
+	if err := w.Reload(); err != nil {
+		return nil, err
+	}
+	if w.interval > 0 {
+		go w.watch()
+	}
+	return w, nil
+}
+
+// Reload loads the file.
+func (w *fileWatcher) Reload() error {
+	info, err := os.Stat(w.path)
+	if err != nil {
+		return err
+	}
+	data, err := os.ReadFile(w.path)
+	if err != nil {
+		return err
+	}
+	if err := w.load(data); err != nil {
+		return err
+	}
+	w.mu.Lock()
+	w.modTime = info.ModTime()
+	w.mu.Unlock()
+	return nil
+}
+
+// Close stops the reload.
+func (w *fileWatcher) Close() error {
+	w.once.Do(func() { close(w.done) })
+	return nil
+}
+
+func (w *fileWatcher) watch() {
+	ticker := time.NewTicker(w.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-w.done:
+			return
+		case <-ticker.C:
+			info, err := os.Stat(w.path)
+			if err != nil {
+				w.onError(err)
+				continue
+			}
+			w.mu.Lock()
+			changed := !info.ModTime().Equal(w.modTime)
+			w.mu.Unlock()
+			if !changed {
+				continue
+			}
+			if err := w.Reload(); err != nil {
+				w.onError(err)
+			}
+		}
+	}
+}
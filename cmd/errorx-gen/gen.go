@@ -0,0 +1,186 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"go/format"
+	"io"
+	"sort"
+	"strings"
+	"text/template"
+
+	errorutil "github.com/XuThreeFire/goutil/errorx"
+)
+
+var codeTemplate = template.Must(template.New("errors").Funcs(template.FuncMap{
+	"options": options,
+	"comment": comment,
+}).Parse(`// Code generated by errorx-gen. DO NOT EDIT.
+
+package {{ .Package }}
+
+import (
+	"errors"
+
+	errorutil "github.com/XuThreeFire/goutil/errorx"
+{{- if .UseCodes }}
+	"google.golang.org/grpc/codes"
+{{- end }}
+)
+{{ if .Namespace }}
+// Namespace is the code range reserved for the {{ .Namespace.Name }} codes.
+var Namespace = errorutil.RegisterNamespace({{ printf "%q" .Namespace.Name }}, {{ .Namespace.Min }}, {{ .Namespace.Max }})
+{{ end }}
+var (
+{{- range .Errors }}
+	// Err{{ .Name }} {{ comment .Reason }}
+	Err{{ .Name }} = {{ if $.Namespace }}Namespace.Register{{ else }}errorutil.Register{{ end }}({{ .Code }}, {{ printf "%q" .Reason }},{{ options . }})
+{{- end }}
+)
+{{ range .Errors }}
+// Is{{ .Name }} determines if err is Err{{ .Name }}.
+// It supports wrapped errors.
+func Is{{ .Name }}(err error) bool {
+	return errors.Is(err, Err{{ .Name }})
+}
+{{ end }}`))
+
+// Generate writes the go source of the spec.
+func Generate(w io.Writer, spec *Spec) error {
+	useCodes := false
+	for _, e := range spec.Errors {
+		useCodes = useCodes || e.GRPC != ""
+	}
+	var buf bytes.Buffer
+	if err := codeTemplate.Execute(&buf, struct {
+		*Spec
+		UseCodes bool
+	}{spec, useCodes}); err != nil {
+		return err
+	}
+	src, err := format.Source(buf.Bytes())
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(src)
+	return err
+}
+
+// Check checks the codes of the spec against the errorx codes registered in this
+// process, e.g. the common codes, without registering them, so it can run repeatedly.
+func Check(spec *Spec) error {
+	namespaces := []errorutil.Namespace{*errorutil.CommonNamespace}
+	if ns := spec.Namespace; ns != nil {
+		for _, other := range namespaces {
+			if ns.Name == other.Name {
+				return fmt.Errorf("namespace %q is already registered", ns.Name)
+			}
+			if ns.Min <= other.Max && other.Min <= ns.Max {
+				return fmt.Errorf("namespace %q [%d, %d] overlaps %q [%d, %d]", ns.Name, ns.Min, ns.Max, other.Name, other.Min, other.Max)
+			}
+		}
+		for _, def := range errorutil.Catalog() {
+			if def.Code >= ns.Min && def.Code <= ns.Max {
+				return fmt.Errorf("namespace %q [%d, %d] contains the registered code %d", ns.Name, ns.Min, ns.Max, def.Code)
+			}
+		}
+	}
+	for _, e := range spec.Errors {
+		if def, ok := errorutil.Lookup(e.Code); ok {
+			return fmt.Errorf("%s code %d is already registered as %q", e.Name, e.Code, def.Reason)
+		}
+		if spec.Namespace != nil {
+			continue
+		}
+		for _, ns := range namespaces {
+			if e.Code >= ns.Min && e.Code <= ns.Max {
+				return fmt.Errorf("%s code %d is reserved by namespace %q", e.Name, e.Code, ns.Name)
+			}
+		}
+	}
+	return nil
+}
+
+// GenerateMarkdown writes the catalog of the codes of the spec, see Check for the collisions.
+func GenerateMarkdown(w io.Writer, spec *Spec) error {
+	defs := make([]errorutil.Definition, 0, len(spec.Errors))
+	for _, e := range spec.Errors {
+		def := errorutil.Definition{
+			Code:        e.Code,
+			Reason:      e.Reason,
+			Description: e.Description,
+			Reasons:     e.Reasons,
+			HTTPStatus:  e.HTTP,
+			GRPCCode:    e.grpcCode,
+			Class:       e.class(),
+		}
+		if spec.Namespace != nil {
+			def.Namespace = spec.Namespace.Name
+		}
+		defs = append(defs, def)
+	}
+	sort.Slice(defs, func(i, j int) bool {
+		return defs[i].Code < defs[j].Code
+	})
+	return errorutil.WriteMarkdown(w, defs)
+}
+
+func (e *SpecError) class() errorutil.Class {
+	var class errorutil.Class
+	for _, f := range []struct {
+		set   bool
+		class errorutil.Class
+	}{
+		{e.Retryable, errorutil.ClassRetryable},
+		{e.Temporary, errorutil.ClassTemporary},
+		{e.ClientFault, errorutil.ClassClientFault},
+		{e.ServerFault, errorutil.ClassServerFault},
+	} {
+		if f.set {
+			class |= f.class
+		}
+	}
+	return class
+}
+
+// comment escapes the line breaks of s, which would end a line comment.
+func comment(s string) string {
+	return strings.NewReplacer("\r", `\r`, "\n", `\n`).Replace(s)
+}
+
+func options(e *SpecError) string {
+	var opts []string
+	for _, locale := range sortedKeys(e.Reasons) {
+		opts = append(opts, "errorutil.WithLocaleReason("+quote(locale)+", "+quote(e.Reasons[locale])+")")
+	}
+	if e.Description != "" {
+		opts = append(opts, "errorutil.WithDescription("+quote(e.Description)+")")
+	}
+	if e.HTTP != 0 {
+		opts = append(opts, "errorutil.WithHTTPStatus("+itoa(e.HTTP)+")")
+	}
+	if e.GRPC != "" {
+		opts = append(opts, "errorutil.WithGRPCCode(codes."+e.GRPC+")")
+	}
+	var classes []string
+	for _, f := range []struct {
+		set  bool
+		name string
+	}{
+		{e.Retryable, "ClassRetryable"},
+		{e.Temporary, "ClassTemporary"},
+		{e.ClientFault, "ClassClientFault"},
+		{e.ServerFault, "ClassServerFault"},
+	} {
+		if f.set {
+			classes = append(classes, "errorutil."+f.name)
+		}
+	}
+	if len(classes) > 0 {
+		opts = append(opts, "errorutil.WithClass("+strings.Join(classes, "|")+")")
+	}
+	if len(opts) == 0 {
+		return ""
+	}
+	return "\n\t\t" + strings.Join(opts, ",\n\t\t") + ",\n\t"
+}
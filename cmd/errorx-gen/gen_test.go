@@ -0,0 +1,153 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestGenerate(t *testing.T) {
+	spec, err := LoadSpec("testdata/errors.yaml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var src bytes.Buffer
+	if err := Generate(&src, spec); err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{
+		`var Namespace = errorutil.RegisterNamespace("order", 20000, 20999)`,
+		`ErrOrderNotFound = Namespace.Register(20001, "订单不存在",`,
+		`errorutil.WithGRPCCode(codes.NotFound),`,
+		`errorutil.WithClass(errorutil.ClassRetryable|errorutil.ClassTemporary),`,
+		`ErrOrderClosed = Namespace.Register(20003, "订单已关闭")`,
+		`func IsOrderLocked(err error) bool {`,
+	} {
+		if !strings.Contains(src.String(), want) {
+			t.Errorf("generated source missing %q:\n%s", want, src.String())
+		}
+	}
+
+	var doc bytes.Buffer
+	if err := GenerateMarkdown(&doc, spec); err != nil {
+		t.Fatal(err)
+	}
+	if want := "| 20001 | order | 404 | NotFound | client_fault | 订单不存在 | order not found |"; !strings.Contains(doc.String(), want) {
+		t.Errorf("markdown missing %q:\n%s", want, doc.String())
+	}
+	if strings.Contains(doc.String(), "| 102 |") {
+		t.Errorf("markdown has the common codes:\n%s", doc.String())
+	}
+}
+
+func TestGenerateComment(t *testing.T) {
+	spec := &Spec{Package: "order", Errors: []*SpecError{
+		{Name: "OrderInvalid", Code: 29001, Reason: "订单无效\nfunc init() { panic(1) }"},
+	}}
+	var src bytes.Buffer
+	if err := Generate(&src, spec); err != nil {
+		t.Fatal(err)
+	}
+	if want := `// ErrOrderInvalid 订单无效\nfunc init() { panic(1) }`; !strings.Contains(src.String(), want) {
+		t.Errorf("generated source missing %q:\n%s", want, src.String())
+	}
+}
+
+func TestLoadSpecErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		spec string
+		want string
+	}{
+		{"duplicate code", `
+package: order
+errors:
+  - {name: OrderNotFound, code: 20001, reason: 订单不存在}
+  - {name: OrderClosed, code: 20001, reason: 订单已关闭}
+`, "has the code 20001 of OrderNotFound"},
+		{"out of namespace", `
+package: order
+namespace: {name: order, min: 20000, max: 20999}
+errors:
+  - {name: OrderNotFound, code: 21001, reason: 订单不存在}
+`, `code 21001 out of namespace "order"`},
+		{"invalid namespace", `
+package: order
+namespace: {name: order, min: 20999, max: 20000}
+`, "invalid namespace"},
+		{"no errors", `
+package: order
+namespace: {name: order, min: 20000, max: 20999}
+`, "errors are required"},
+		{"grpc OK", `
+package: order
+errors:
+  - {name: OrderNotFound, code: 20001, reason: 订单不存在, grpc: OK}
+`, `invalid grpc code "OK"`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "errors.yaml")
+			if err := os.WriteFile(path, []byte(tt.spec), 0o600); err != nil {
+				t.Fatal(err)
+			}
+			if _, err := LoadSpec(path); err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("LoadSpec() = %v, want %q", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestRun(t *testing.T) {
+	dir := t.TempDir()
+	out, doc := filepath.Join(dir, "errors_gen.go"), filepath.Join(dir, "errors.md")
+	// the registry is left untouched, so the spec can be generated again
+	for i := 0; i < 2; i++ {
+		if err := run("testdata/errors.yaml", out, doc); err != nil {
+			t.Fatalf("run() #%d = %v", i, err)
+		}
+	}
+
+	tests := []struct {
+		name string
+		spec string
+		want string
+	}{
+		{"common code", `
+package: order
+errors:
+  - {name: Internal, code: 107, reason: 内部错误}
+`, "code 107 is already registered"},
+		{"common namespace", `
+package: order
+errors:
+  - {name: Reserved, code: 199, reason: 保留}
+`, `code 199 is reserved by namespace "common"`},
+		{"overlapping namespace", `
+package: order
+namespace: {name: order, min: 150, max: 20999}
+errors:
+  - {name: OrderNotFound, code: 20001, reason: 订单不存在}
+`, `overlaps "common"`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			spec := filepath.Join(dir, "errors.yaml")
+			if err := os.WriteFile(spec, []byte(tt.spec), 0o600); err != nil {
+				t.Fatal(err)
+			}
+			out, doc := filepath.Join(dir, "errors_gen.go"), filepath.Join(dir, "errors.md")
+			if err := run(spec, out, doc); err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("run() = %v, want %q", err, tt.want)
+			}
+			for _, path := range []string{out, doc} {
+				if _, err := os.Stat(path); !os.IsNotExist(err) {
+					t.Errorf("run() left %s: %v", path, err)
+				}
+			}
+		})
+	}
+}
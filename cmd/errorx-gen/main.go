@@ -0,0 +1,79 @@
+// Command errorx-gen generates errorx sentinels, Is helpers and a markdown catalog
+// from a yaml spec, e.g.
+//
+//	//go:generate go run github.com/XuThreeFire/goutil/cmd/errorx-gen -spec errors.yaml -out errors_gen.go -doc errors.md
+//
+// spec:
+//
+//	package: order
+//	namespace: {name: order, min: 20000, max: 20999}
+//	errors:
+//	  - name: OrderNotFound
+//	    code: 20001
+//	    reason: 订单不存在
+//	    reasons: {en: order not found}
+//	    http: 404
+//	    grpc: NotFound
+//	    retryable: false
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+)
+
+func main() {
+	specPath := flag.String("spec", "errors.yaml", "the yaml spec file")
+	out := flag.String("out", "errors_gen.go", "the generated go file")
+	doc := flag.String("doc", "", "the generated markdown catalog, skipped if empty")
+	flag.Parse()
+
+	if err := run(*specPath, *out, *doc); err != nil {
+		fmt.Fprintln(os.Stderr, "errorx-gen:", err)
+		os.Exit(1)
+	}
+}
+
+func run(specPath, out, doc string) error {
+	spec, err := LoadSpec(specPath)
+	if err != nil {
+		return err
+	}
+	if err := Check(spec); err != nil {
+		return fmt.Errorf("%s: %w", specPath, err)
+	}
+	// generate both files before writing any, so a failed run leaves no partial output
+	var src, md bytes.Buffer
+	if err := Generate(&src, spec); err != nil {
+		return err
+	}
+	if doc != "" {
+		if err := GenerateMarkdown(&md, spec); err != nil {
+			return err
+		}
+	}
+	if err := os.WriteFile(out, src.Bytes(), 0o644); err != nil {
+		return err
+	}
+	if doc == "" {
+		return nil
+	}
+	return os.WriteFile(doc, md.Bytes(), 0o644)
+}
+
+func sortedKeys(m map[string]string) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func quote(s string) string { return strconv.Quote(s) }
+
+func itoa(i int) string { return strconv.Itoa(i) }
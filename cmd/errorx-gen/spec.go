@@ -0,0 +1,102 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"regexp"
+
+	"google.golang.org/grpc/codes"
+	"gopkg.in/yaml.v3"
+)
+
+// Spec is the errorx definitions of a package.
+type Spec struct {
+	Package   string       `yaml:"package"`
+	Namespace *SpecRange   `yaml:"namespace"`
+	Errors    []*SpecError `yaml:"errors"`
+}
+
+// SpecRange is the code range reserved by the service.
+type SpecRange struct {
+	Name string `yaml:"name"`
+	Min  int    `yaml:"min"`
+	Max  int    `yaml:"max"`
+}
+
+// SpecError is one errorx definition.
+type SpecError struct {
+	Name        string            `yaml:"name"`
+	Code        int               `yaml:"code"`
+	Reason      string            `yaml:"reason"`
+	Reasons     map[string]string `yaml:"reasons"`
+	Description string            `yaml:"description"`
+	HTTP        int               `yaml:"http"`
+	GRPC        string            `yaml:"grpc"`
+	Retryable   bool              `yaml:"retryable"`
+	Temporary   bool              `yaml:"temporary"`
+	ClientFault bool              `yaml:"clientFault"`
+	ServerFault bool              `yaml:"serverFault"`
+
+	grpcCode codes.Code
+}
+
+var identRegexp = regexp.MustCompile(`^[A-Z][A-Za-z0-9]*$`)
+
+// LoadSpec reads and validates the yaml spec file.
+func LoadSpec(path string) (*Spec, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	spec := new(Spec)
+	if err := yaml.Unmarshal(data, spec); err != nil {
+		return nil, fmt.Errorf("parse %s: %w", path, err)
+	}
+	if spec.Package == "" {
+		return nil, fmt.Errorf("%s: package is required", path)
+	}
+	if ns := spec.Namespace; ns != nil && (ns.Name == "" || ns.Min > ns.Max) {
+		return nil, fmt.Errorf("%s: invalid namespace %q [%d, %d]", path, ns.Name, ns.Min, ns.Max)
+	}
+	if len(spec.Errors) == 0 {
+		return nil, fmt.Errorf("%s: errors are required", path)
+	}
+	names := make(map[string]struct{}, len(spec.Errors))
+	codes := make(map[int]string, len(spec.Errors))
+	for _, e := range spec.Errors {
+		if !identRegexp.MatchString(e.Name) {
+			return nil, fmt.Errorf("%s: invalid error name %q", path, e.Name)
+		}
+		if _, ok := names[e.Name]; ok {
+			return nil, fmt.Errorf("%s: duplicate error name %q", path, e.Name)
+		}
+		names[e.Name] = struct{}{}
+		if e.Code == 0 || e.Reason == "" {
+			return nil, fmt.Errorf("%s: %s requires code and reason", path, e.Name)
+		}
+		if other, ok := codes[e.Code]; ok {
+			return nil, fmt.Errorf("%s: %s has the code %d of %s", path, e.Name, e.Code, other)
+		}
+		codes[e.Code] = e.Name
+		if ns := spec.Namespace; ns != nil && (e.Code < ns.Min || e.Code > ns.Max) {
+			return nil, fmt.Errorf("%s: %s code %d out of namespace %q [%d, %d]", path, e.Name, e.Code, ns.Name, ns.Min, ns.Max)
+		}
+		if e.GRPC != "" {
+			code, ok := grpcCodes[e.GRPC]
+			if !ok {
+				return nil, fmt.Errorf("%s: %s has invalid grpc code %q", path, e.Name, e.GRPC)
+			}
+			e.grpcCode = code
+		}
+	}
+	return spec, nil
+}
+
+var grpcCodes = func() map[string]codes.Code {
+	m := make(map[string]codes.Code)
+	// OK is not the code of an error
+	for c := codes.Canceled; c <= codes.Unauthenticated; c++ {
+		m[c.String()] = c
+	}
+	return m
+}()
@@ -0,0 +1,143 @@
+package errorutil
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/anypb"
+)
+
+// ItemError is the errorx of one item of a batch request.
+type ItemError struct {
+	Index int
+	Err   *Error
+}
+
+// MarshalJSON encodes the item in the statusCode/statusReason shape with its index.
+func (i ItemError) MarshalJSON() ([]byte, error) {
+	return json.Marshal(struct {
+		Index        int               `json:"index"`
+		StatusCode   int32             `json:"statusCode"`
+		StatusReason string            `json:"statusReason"`
+		Metadata     map[string]string `json:"metadata,omitempty"`
+	}{i.Index, i.Err.StatusCode, i.Err.StatusReason, i.Err.Metadata})
+}
+
+// BatchError aggregates the errorx errors of the items of a batch request.
+// It is safe for concurrent use.
+type BatchError struct {
+	status *Error
+	items  []ItemError
+	mu     sync.Mutex
+}
+
+// NewBatchError news a batch error reported with the status,
+// ErrIllegalData if status is nil.
+func NewBatchError(status *Error) *BatchError {
+	if status == nil {
+		status = ErrIllegalData
+	}
+	return &BatchError{status: status}
+}
+
+// Add adds the error of the item at index, nil errors are ignored.
+func (b *BatchError) Add(index int, err error) {
+	if err == nil {
+		return
+	}
+	b.mu.Lock()
+	b.items = append(b.items, ItemError{Index: index, Err: FromError(err)})
+	b.mu.Unlock()
+}
+
+// Items returns the failed items ordered by index.
+func (b *BatchError) Items() []ItemError {
+	b.mu.Lock()
+	items := append([]ItemError(nil), b.items...)
+	b.mu.Unlock()
+	sort.SliceStable(items, func(i, j int) bool {
+		return items[i].Index < items[j].Index
+	})
+	return items
+}
+
+// Len returns the number of failed items.
+func (b *BatchError) Len() int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return len(b.items)
+}
+
+// Err returns the batch error, or nil if no item failed.
+func (b *BatchError) Err() error {
+	if b.Len() == 0 {
+		return nil
+	}
+	return b
+}
+
+// Counts returns the number of failed items by status code.
+func (b *BatchError) Counts() map[int32]int {
+	counts := make(map[int32]int)
+	for _, item := range b.Items() {
+		counts[item.Err.StatusCode]++
+	}
+	return counts
+}
+
+// Summary returns the failed items count and codes, e.g. "3 items failed [104x2 110x1]".
+func (b *BatchError) Summary() string {
+	counts := b.Counts()
+	codes := make([]int, 0, len(counts))
+	for code := range counts {
+		codes = append(codes, int(code))
+	}
+	sort.Ints(codes)
+	parts := make([]string, 0, len(codes))
+	for _, code := range codes {
+		parts = append(parts, fmt.Sprintf("%dx%d", code, counts[int32(code)]))
+	}
+	return fmt.Sprintf("%d items failed [%s]", b.Len(), strings.Join(parts, " "))
+}
+
+func (b *BatchError) Error() string {
+	return b.status.Error() + ":" + b.Summary()
+}
+
+// Unwrap returns the errorx status of the batch.
+func (b *BatchError) Unwrap() error { return b.status }
+
+// GRPCStatus returns the status of the batch, each failed item is carried
+// as an ErrorInfo detail with its index in the metadata.
+func (b *BatchError) GRPCStatus() *status.Status {
+	st := b.status.GRPCStatus().Proto()
+	for _, item := range b.Items() {
+		md := map[string]string{"index": strconv.Itoa(item.Index)}
+		for k, v := range item.Err.Metadata {
+			md[k] = v
+		}
+		info, _ := anypb.New(&errdetails.ErrorInfo{
+			Reason:   strconv.Itoa(int(item.Err.StatusCode)),
+			Domain:   ErrorDomain + "/item",
+			Metadata: md,
+		})
+		st.Details = append(st.Details, info)
+	}
+	return status.FromProto(st)
+}
+
+// MarshalJSON encodes the batch in the statusCode/statusReason shape with an items array.
+func (b *BatchError) MarshalJSON() ([]byte, error) {
+	return json.Marshal(struct {
+		StatusCode   int32       `json:"statusCode"`
+		StatusReason string      `json:"statusReason"`
+		ResultStatus bool        `json:"resultStatus"`
+		Items        []ItemError `json:"items"`
+	}{b.status.StatusCode, b.status.StatusReason, b.status.ResultStatus, b.Items()})
+}
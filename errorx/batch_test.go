@@ -0,0 +1,34 @@
+package errorutil
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+)
+
+func TestBatchError(t *testing.T) {
+	b := NewBatchError(nil)
+	if b.Err() != nil {
+		t.Fatal("Err() of an empty batch must be nil")
+	}
+	b.Add(2, ErrIllegalData.WithMessage("price"))
+	b.Add(0, ErrEmptyParam)
+	b.Add(1, nil)
+	b.Add(3, ErrIllegalData)
+
+	err := b.Err()
+	if !errors.Is(err, ErrIllegalData) {
+		t.Errorf("errors.Is() = false, want true")
+	}
+	if got, want := b.Summary(), "3 items failed [105x1 110x2]"; got != want {
+		t.Errorf("Summary() = %s, want %s", got, want)
+	}
+	data, _ := json.Marshal(err)
+	want := `{"statusCode":110,"statusReason":"信息有误或不完整","resultStatus":false,"items":[` +
+		`{"index":0,"statusCode":105,"statusReason":"请求数据为空"},` +
+		`{"index":2,"statusCode":110,"statusReason":"信息有误或不完整:price"},` +
+		`{"index":3,"statusCode":110,"statusReason":"信息有误或不完整"}]}`
+	if string(data) != want {
+		t.Errorf("json = %s, want %s", data, want)
+	}
+}
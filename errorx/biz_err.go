@@ -1,7 +1,8 @@
 package errorutil
 
 import (
-	"github.com/pkg/errors"
+	"errors"
+	"sort"
 )
 
 const (
@@ -11,37 +12,41 @@ const (
 	ReceiveSuccessMsg  = "ReceiveSuccess"
 )
 
-// BizErr is a definition of error
+// DefaultMapper is the mapper used by SetErrMap and ErrCode.
+var DefaultMapper = NewMapper()
 
-var errMap = map[error]int32{
-	// TODO realize your errorMay
-}
-
-// SetErrMap set you errorMap
+// SetErrMap set you errorMap, an error matching several targets gets the lowest code,
+// or with the same code the target with the lowest message.
+//
+// Deprecated: use a Mapper with Is rules instead.
 func SetErrMap(e map[error]int32) {
-	errMap = e
-}
-
-// ErrCode 匹配 错误码
-func ErrCode(err error) (int32, string) {
-	if len(errMap) == 0 {
-		panic("use SetErrMap to realize your err map!")
+	targets := make([]error, 0, len(e))
+	for target := range e {
+		targets = append(targets, target)
 	}
-	var code int32
-	var msg string
-
-	if err != nil {
-		oriErr := errors.Cause(err)
-		if defCode, ok := errMap[oriErr]; ok {
-			code = defCode
-		} else {
-			code = UnknownCode
+	// the map order is random, sort the rules so the first match is the same on every run
+	sort.Slice(targets, func(i, j int) bool {
+		if e[targets[i]] != e[targets[j]] {
+			return e[targets[i]] < e[targets[j]]
 		}
-		msg = err.Error()
-	} else {
-		code = SuccessCode
-		msg = SuccessMsg
+		return targets[i].Error() < targets[j].Error()
+	})
+	rules := make([]mapperRule, 0, len(targets))
+	for _, target := range targets {
+		target := target
+		rules = append(rules, mapperRule{
+			match: func(err error) bool { return errors.Is(err, target) },
+			to:    New(int(e[target]), target.Error(), false),
+		})
 	}
+	DefaultMapper.mu.Lock()
+	DefaultMapper.rules = rules
+	DefaultMapper.mu.Unlock()
+}
 
-	return code, msg
+// ErrCode 匹配 错误码
+//
+// Deprecated: use DefaultMapper.Code or a Mapper instead.
+func ErrCode(err error) (int32, string) {
+	return DefaultMapper.Code(err)
 }
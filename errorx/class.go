@@ -0,0 +1,117 @@
+package errorutil
+
+import (
+	"context"
+	"errors"
+	"strings"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// Class is the classification flags of an errorx code.
+type Class uint8
+
+const (
+	// ClassRetryable the request is safe to retry.
+	ClassRetryable Class = 1 << iota
+	// ClassTemporary the failure is expected to go away.
+	ClassTemporary
+	// ClassClientFault the failure is caused by the request.
+	ClassClientFault
+	// ClassServerFault the failure is caused by the server or its dependencies.
+	ClassServerFault
+)
+
+// String returns the flag names joined by "|".
+func (c Class) String() string {
+	var names []string
+	for _, f := range []struct {
+		class Class
+		name  string
+	}{
+		{ClassRetryable, "retryable"},
+		{ClassTemporary, "temporary"},
+		{ClassClientFault, "client_fault"},
+		{ClassServerFault, "server_fault"},
+	} {
+		if c&f.class != 0 {
+			names = append(names, f.name)
+		}
+	}
+	return strings.Join(names, "|")
+}
+
+// MarshalText encodes the flag names, e.g. "retryable|temporary|server_fault".
+func (c Class) MarshalText() ([]byte, error) {
+	return []byte(c.String()), nil
+}
+
+// WithClass with the classification flags of the code.
+// If not declared the flags are derived from the grpc code of the code.
+func WithClass(class Class) Option {
+	return func(d *Definition) {
+		d.Class = class
+	}
+}
+
+// Classify returns the classification flags of err.
+// It supports wrapped errors, errors with a grpc status and temporary errors.
+func Classify(err error) Class {
+	if err == nil || errors.Is(err, context.Canceled) {
+		return 0
+	}
+	if se := new(Error); errors.As(err, &se) {
+		def, _ := Lookup(int(se.StatusCode))
+		return def.class()
+	}
+	if errors.Is(err, context.DeadlineExceeded) {
+		// like ErrDeadlineExceeded, not retryable though it is a temporary error
+		return classOf(codes.DeadlineExceeded)
+	}
+	class := ClassServerFault
+	var se interface{ GRPCStatus() *status.Status }
+	if errors.As(err, &se) {
+		class = classOf(se.GRPCStatus().Code())
+	}
+	var temporary interface{ Temporary() bool }
+	if errors.As(err, &temporary) && temporary.Temporary() {
+		class |= ClassTemporary | ClassRetryable
+	}
+	return class
+}
+
+// IsRetryable determines if err is safe to retry.
+func IsRetryable(err error) bool { return Classify(err)&ClassRetryable != 0 }
+
+// IsTemporary determines if err is expected to go away.
+func IsTemporary(err error) bool { return Classify(err)&ClassTemporary != 0 }
+
+// IsClientFault determines if err is caused by the request.
+func IsClientFault(err error) bool { return Classify(err)&ClassClientFault != 0 }
+
+// IsServerFault determines if err is caused by the server or its dependencies.
+func IsServerFault(err error) bool { return Classify(err)&ClassServerFault != 0 }
+
+func (d Definition) class() Class {
+	if d.Class != 0 {
+		return d.Class
+	}
+	_, code := d.transportStatus()
+	return classOf(code)
+}
+
+func classOf(code codes.Code) Class {
+	switch code {
+	case codes.OK, codes.Canceled:
+		return 0
+	case codes.Unavailable, codes.ResourceExhausted, codes.Aborted:
+		return ClassRetryable | ClassTemporary | ClassServerFault
+	case codes.DeadlineExceeded:
+		return ClassTemporary | ClassServerFault
+	case codes.InvalidArgument, codes.NotFound, codes.AlreadyExists, codes.PermissionDenied,
+		codes.Unauthenticated, codes.FailedPrecondition, codes.OutOfRange, codes.Unimplemented:
+		return ClassClientFault
+	}
+	return ClassServerFault
+}
@@ -0,0 +1,37 @@
+package errorutil
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestClassify(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want Class
+	}{
+		{"nil", nil, 0},
+		{"client", ErrSignatureError, ClassClientFault},
+		{"server", ErrInternalError.WithMessage("db"), ClassServerFault},
+		{"deadline exceeded", ErrDeadlineExceeded, ClassTemporary | ClassServerFault},
+		{"overloaded", ErrOverloaded, ClassRetryable | ClassTemporary | ClassServerFault},
+		{"too many requests", ErrTooManyRequests, ClassRetryable | ClassTemporary | ClassClientFault},
+		{"unavailable", status.Error(codes.Unavailable, "down"), ClassRetryable | ClassTemporary | ClassServerFault},
+		{"deadline", fmt.Errorf("call: %w", context.DeadlineExceeded), ClassTemporary | ClassServerFault},
+		{"canceled", context.Canceled, 0},
+		{"plain", errors.New("boom"), ClassServerFault},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Classify(tt.err); got != tt.want {
+				t.Errorf("Classify() = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
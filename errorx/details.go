@@ -0,0 +1,116 @@
+package errorutil
+
+import (
+	"fmt"
+	"io"
+	"runtime"
+
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/anypb"
+)
+
+const maxStackDepth = 32
+
+// WithDetails returns a copy of the errorx with the structured details appended,
+// e.g. the google.rpc errdetails messages. Details are carried in the grpc status.
+func (e *Error) WithDetails(details ...proto.Message) *Error {
+	err := Clone(e)
+	for _, d := range details {
+		detail, marshalErr := anypb.New(d)
+		if marshalErr != nil {
+			continue
+		}
+		err.Status.Details = append(err.Status.Details, detail)
+	}
+	return err
+}
+
+// WithFieldViolation returns a copy of the errorx with a BadRequest detail
+// describing the invalid request field.
+func (e *Error) WithFieldViolation(field, desc string) *Error {
+	return e.WithDetails(&errdetails.BadRequest{
+		FieldViolations: []*errdetails.BadRequest_FieldViolation{{Field: field, Description: desc}},
+	})
+}
+
+// WithUpstream returns a copy of the errorx caused by the failed upstream dependency,
+// the upstream is recorded as an ErrorInfo detail.
+func (e *Error) WithUpstream(upstream string, cause error) *Error {
+	info := &errdetails.ErrorInfo{Domain: upstream}
+	if cause != nil {
+		info.Reason = cause.Error()
+	}
+	err := e.WithDetails(info)
+	err.cause = cause
+	return err
+}
+
+// WithStack returns a copy of the errorx with the stack of the caller,
+// it is printed by the %+v verb and never sent to clients.
+func (e *Error) WithStack() *Error {
+	err := Clone(e)
+	pcs := make([]uintptr, maxStackDepth)
+	n := runtime.Callers(2, pcs) //nolint:gomnd
+	err.stack = pcs[:n]
+	return err
+}
+
+// UnpackDetails returns the structured details of the errorx,
+// details of unknown types are skipped.
+func (e *Error) UnpackDetails() []proto.Message {
+	details := make([]proto.Message, 0, len(e.Status.Details))
+	for _, detail := range e.Status.Details {
+		d, err := detail.UnmarshalNew()
+		if err != nil {
+			continue
+		}
+		details = append(details, d)
+	}
+	return details
+}
+
+// StackTrace returns the frames captured by WithStack.
+func (e *Error) StackTrace() []runtime.Frame {
+	if len(e.stack) == 0 {
+		return nil
+	}
+	var trace []runtime.Frame
+	frames := runtime.CallersFrames(e.stack)
+	for {
+		frame, more := frames.Next()
+		trace = append(trace, frame)
+		if !more {
+			return trace
+		}
+	}
+}
+
+// Format implements fmt.Formatter, the %+v verb prints the status, details,
+// stack and the cause chain.
+func (e *Error) Format(s fmt.State, verb rune) {
+	switch verb {
+	case 'v':
+		if s.Flag('+') {
+			fmt.Fprintf(s, "errorx: statusCode = %d statusReason = %s", e.StatusCode, e.StatusReason)
+			if len(e.Metadata) > 0 {
+				fmt.Fprintf(s, " metadata = %v", e.Metadata)
+			}
+			for _, d := range e.UnpackDetails() {
+				fmt.Fprintf(s, "\n\tdetail: %s %v", d.ProtoReflect().Descriptor().FullName(), d)
+			}
+			for _, frame := range e.StackTrace() {
+				fmt.Fprintf(s, "\n%s\n\t%s:%d", frame.Function, frame.File, frame.Line)
+			}
+			if e.cause != nil {
+				fmt.Fprintf(s, "\ncaused by: %+v", e.cause)
+			}
+			return
+		}
+		fallthrough
+	case 's':
+		_, _ = io.WriteString(s, e.Error())
+	case 'q':
+		fmt.Fprintf(s, "%q", e.Error())
+	}
+}
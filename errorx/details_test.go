@@ -0,0 +1,45 @@
+package errorutil
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/status"
+)
+
+func TestDetailsGRPCStatus(t *testing.T) {
+	err := ErrIllegalData.WithFieldViolation("mobile", "invalid format")
+	se := FromError(status.Convert(err).Err())
+	if se.StatusCode != ErrIllegalData.StatusCode {
+		t.Fatalf("FromError() code = %d, want %d", se.StatusCode, ErrIllegalData.StatusCode)
+	}
+	details := se.UnpackDetails()
+	if len(details) != 1 {
+		t.Fatalf("UnpackDetails() = %v", details)
+	}
+	br, ok := details[0].(*errdetails.BadRequest)
+	if !ok || br.FieldViolations[0].Field != "mobile" {
+		t.Errorf("UnpackDetails() = %v", details[0])
+	}
+}
+
+func TestFormat(t *testing.T) {
+	err := ErrInternalError.WithUpstream("user-service", errors.New("connection refused")).WithStack()
+	if got := fmt.Sprintf("%v", err); got != ErrInternalError.StatusReason {
+		t.Errorf("%%v = %s", got)
+	}
+	got := fmt.Sprintf("%+v", err)
+	for _, want := range []string{
+		"statusCode = 107",
+		"google.rpc.ErrorInfo",
+		"TestFormat",
+		"caused by: connection refused",
+	} {
+		if !strings.Contains(got, want) {
+			t.Errorf("%%+v missing %q:\n%s", want, got)
+		}
+	}
+}
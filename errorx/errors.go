@@ -2,11 +2,18 @@ package errorutil
 
 import (
 	"errors"
+	"strconv"
 
-	"google.golang.org/grpc/codes"
+	"github.com/XuThreeFire/goutil/errorx/errorpb"
+
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	spb "google.golang.org/genproto/googleapis/rpc/status"
 	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/anypb"
 )
 
+//go:generate protoc -I. --go_out=.. --go_opt=module=github.com/XuThreeFire/goutil error_type.proto
+
 const (
 	// UnknownCode is unknown code for errorx info.
 	UnknownCode = 107
@@ -14,28 +21,117 @@ const (
 	UnknownReason = "内部操作失败"
 )
 
+// Status is the wire message of an Error, ecode.Error of error_type.proto.
+type Status = errorpb.Error
+
+// Error is a business status error.
+// An Error is never modified once created, the With* methods return a copy,
+// so package-level sentinels are safe to share between goroutines.
+type Error struct {
+	Status
+	cause error
+	stack []uintptr
+}
+
 func (e *Error) Error() string {
 	// return fmt.Sprintf("errorx: statusCode = %d statusReason = %s resultStatus = %t", e.StatusCode, e.StatusReason, e.ResultStatus)
 	return e.StatusReason
 }
 
-// AddMsg returns ecode.Error with msg.
+// Unwrap provides compatibility for Go 1.13 error chains.
+func (e *Error) Unwrap() error { return e.cause }
+
+// Is matches each errorx in the chain by StatusCode,
+// so a decorated copy still matches the sentinel it was derived from.
+func (e *Error) Is(err error) bool {
+	if se := new(Error); errors.As(err, &se) {
+		return se.StatusCode == e.StatusCode
+	}
+	return false
+}
+
+// WithMessage returns a copy of the errorx with msg appended to the reason.
+func (e *Error) WithMessage(msg string) *Error {
+	err := Clone(e)
+	err.StatusReason += ":" + msg
+	return err
+}
+
+// WithCause returns a copy of the errorx with the underlying cause.
+func (e *Error) WithCause(cause error) *Error {
+	err := Clone(e)
+	err.cause = cause
+	return err
+}
+
+// WithMetadata returns a copy of the errorx with an MD formed by the mapping of key, value.
+func (e *Error) WithMetadata(md map[string]string) *Error {
+	err := Clone(e)
+	err.Metadata = md
+	return err
+}
+
+// AddMsg returns a copy of the errorx with msg.
+//
+// Deprecated: use WithMessage instead.
 func (e *Error) AddMsg(msg string) *Error {
-	e.StatusReason += ":" + msg
-	return e
+	return e.WithMessage(msg)
 }
 
 // GRPCStatus returns the Status represented by se.
+// The grpc code is mapped from the StatusCode, which is carried in an ErrorInfo detail
+// followed by the details of the errorx.
 func (e *Error) GRPCStatus() *status.Status {
-	return status.New(codes.Code(e.StatusCode), e.StatusReason)
+	_, code := transportStatus(e.StatusCode)
+	info, _ := anypb.New(&errdetails.ErrorInfo{
+		Reason:   strconv.Itoa(int(e.StatusCode)),
+		Domain:   ErrorDomain,
+		Metadata: e.Metadata,
+	})
+	return status.FromProto(&spb.Status{
+		Code:    int32(code),
+		Message: e.StatusReason,
+		Details: append([]*anypb.Any{info}, e.Status.Details...),
+	})
 }
 
 // New returns an errorx object for the code, message.
 func New(code int, reason string, status bool) *Error {
 	return &Error{
-		StatusCode:   int32(code),
-		StatusReason: reason,
-		ResultStatus: status,
+		Status: Status{
+			StatusCode:   int32(code),
+			StatusReason: reason,
+			ResultStatus: status,
+		},
+	}
+}
+
+// Clone deep clone errorx to a new errorx.
+func Clone(err *Error) *Error {
+	if err == nil {
+		return nil
+	}
+	var metadata map[string]string
+	if err.Metadata != nil {
+		metadata = make(map[string]string, len(err.Metadata))
+		for k, v := range err.Metadata {
+			metadata[k] = v
+		}
+	}
+	var details []*anypb.Any
+	if err.Status.Details != nil {
+		details = append(make([]*anypb.Any, 0, len(err.Status.Details)), err.Status.Details...)
+	}
+	return &Error{
+		cause: err.cause,
+		stack: err.stack,
+		Status: Status{
+			StatusCode:   err.StatusCode,
+			StatusReason: err.StatusReason,
+			ResultStatus: err.ResultStatus,
+			Metadata:     metadata,
+			Details:      details,
+		},
 	}
 }
 
@@ -69,5 +165,10 @@ func FromError(err error) *Error {
 	if se := new(Error); errors.As(err, &se) {
 		return se
 	}
+	if gs, ok := status.FromError(err); ok {
+		if se := FromGRPCStatus(gs); se != nil {
+			return se
+		}
+	}
 	return New(UnknownCode, err.Error(), false)
 }
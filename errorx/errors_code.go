@@ -1,14 +1,38 @@
 package errorutil
 
+import "google.golang.org/grpc/codes"
+
+// CommonNamespace is the code range reserved for the goutil common codes.
+var CommonNamespace = RegisterNamespace("common", 100, 199)
+
+// Sentinel errors, decorate them with WithMessage/WithCause/WithMetadata
+// and match them with errors.Is.
 var (
-	ErrParseError       = New(101, "数据解析失败", false)
-	ErrSignatureError   = New(102, "签名验证错误", false)
-	ErrIllegaUser       = New(103, "未授权用户", false)
-	ErrDataError        = New(104, "数据型数据解析失败", false)
-	ErrEmptyParam       = New(105, "请求数据为空", false)
-	ErrExpiredSignature = New(106, "签名过期", false)
-	ErrInternalError    = New(107, "内部错误", false)
-	ErrIllegalRequest   = New(108, "非法请求", false)
-	ErrNotFound         = New(109, "未找到对应记录", false)
-	ErrIllegalData      = New(110, "信息有误或不完整", false)
+	ErrParseError = CommonNamespace.Register(101, "数据解析失败",
+		WithLocaleReason("en", "data parse failed"), WithGRPCCode(codes.InvalidArgument))
+	ErrSignatureError = CommonNamespace.Register(102, "签名验证错误",
+		WithLocaleReason("en", "signature verification failed"), WithGRPCCode(codes.Unauthenticated))
+	ErrIllegaUser = CommonNamespace.Register(103, "未授权用户",
+		WithLocaleReason("en", "unauthorized user"), WithGRPCCode(codes.PermissionDenied))
+	ErrDataError = CommonNamespace.Register(104, "数据型数据解析失败",
+		WithLocaleReason("en", "data type parse failed"), WithGRPCCode(codes.InvalidArgument))
+	ErrEmptyParam = CommonNamespace.Register(105, "请求数据为空",
+		WithLocaleReason("en", "empty request data"), WithGRPCCode(codes.InvalidArgument))
+	ErrExpiredSignature = CommonNamespace.Register(106, "签名过期",
+		WithLocaleReason("en", "signature expired"), WithGRPCCode(codes.Unauthenticated))
+	ErrInternalError = CommonNamespace.Register(107, "内部错误",
+		WithLocaleReason("en", "internal error"), WithGRPCCode(codes.Internal))
+	ErrIllegalRequest = CommonNamespace.Register(108, "非法请求",
+		WithLocaleReason("en", "illegal request"), WithGRPCCode(codes.InvalidArgument))
+	ErrNotFound = CommonNamespace.Register(109, "未找到对应记录",
+		WithLocaleReason("en", "record not found"), WithGRPCCode(codes.NotFound))
+	ErrIllegalData = CommonNamespace.Register(110, "信息有误或不完整",
+		WithLocaleReason("en", "incorrect or incomplete information"), WithGRPCCode(codes.InvalidArgument))
+	ErrTooManyRequests = CommonNamespace.Register(111, "请求过于频繁",
+		WithLocaleReason("en", "too many requests"), WithGRPCCode(codes.ResourceExhausted),
+		WithClass(ClassRetryable|ClassTemporary|ClassClientFault))
+	ErrOverloaded = CommonNamespace.Register(112, "服务繁忙",
+		WithLocaleReason("en", "service overloaded"), WithGRPCCode(codes.Unavailable))
+	ErrDeadlineExceeded = CommonNamespace.Register(113, "请求超时",
+		WithLocaleReason("en", "deadline exceeded"), WithGRPCCode(codes.DeadlineExceeded))
 )
@@ -0,0 +1,42 @@
+package errorutil
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+)
+
+func TestWithMessage(t *testing.T) {
+	reason := ErrInternalError.StatusReason
+	err := ErrInternalError.WithMessage("panic")
+	if ErrInternalError.StatusReason != reason {
+		t.Errorf("sentinel mutated: %s", ErrInternalError.StatusReason)
+	}
+	if want := reason + ":panic"; err.StatusReason != want {
+		t.Errorf("WithMessage() = %s, want %s", err.StatusReason, want)
+	}
+}
+
+func TestIs(t *testing.T) {
+	cause := errors.New("bad sign")
+	tests := []struct {
+		name   string
+		err    error
+		target error
+		want   bool
+	}{
+		{"same", ErrSignatureError, ErrSignatureError, true},
+		{"message", ErrSignatureError.WithMessage("md5"), ErrSignatureError, true},
+		{"metadata", ErrSignatureError.WithMetadata(map[string]string{"user": "a"}), ErrSignatureError, true},
+		{"wrapped", fmt.Errorf("auth: %w", ErrSignatureError.WithCause(cause)), ErrSignatureError, true},
+		{"cause", ErrSignatureError.WithCause(cause), cause, true},
+		{"other", ErrSignatureError, ErrIllegaUser, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := errors.Is(tt.err, tt.target); got != tt.want {
+				t.Errorf("errors.Is() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
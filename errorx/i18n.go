@@ -0,0 +1,225 @@
+package errorutil
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"google.golang.org/grpc/status"
+)
+
+type localeKey struct{}
+
+type messageCatalog struct {
+	messages map[string]map[int32]string
+	sync.RWMutex
+}
+
+var defaultCatalog = &messageCatalog{
+	messages: make(map[string]map[int32]string),
+}
+
+// WithLocaleReason with the reason rendered for the locale, e.g. "en".
+func WithLocaleReason(locale, reason string) Option {
+	return func(d *Definition) {
+		if d.Reasons == nil {
+			d.Reasons = make(map[string]string)
+		}
+		d.Reasons[normalizeLocale(locale)] = reason
+	}
+}
+
+// RegisterMessages adds the code to reason messages of the locale,
+// existing messages of the same code are replaced.
+func RegisterMessages(locale string, msgs map[int]string) {
+	c := defaultCatalog
+	locale = normalizeLocale(locale)
+	c.Lock()
+	defer c.Unlock()
+	m, ok := c.messages[locale]
+	if !ok {
+		m = make(map[int32]string, len(msgs))
+		c.messages[locale] = m
+	}
+	for code, reason := range msgs {
+		m[int32(code)] = reason
+	}
+}
+
+// Message returns the reason of the code in the locale.
+// A region locale such as "en-US" falls back to "en".
+func Message(locale string, code int) (string, bool) {
+	c := defaultCatalog
+	locale = normalizeLocale(locale)
+	c.RLock()
+	defer c.RUnlock()
+	for locale != "" {
+		if reason, ok := c.messages[locale][int32(code)]; ok {
+			return reason, true
+		}
+		i := strings.LastIndex(locale, "-")
+		if i < 0 {
+			break
+		}
+		locale = locale[:i]
+	}
+	return "", false
+}
+
+// NewLocaleContext returns a new Context that carries the preferred locales,
+// most preferred first.
+func NewLocaleContext(ctx context.Context, locales ...string) context.Context {
+	return context.WithValue(ctx, localeKey{}, locales)
+}
+
+// LocaleFromContext returns the preferred locales stored in ctx.
+func LocaleFromContext(ctx context.Context) ([]string, bool) {
+	if ctx == nil {
+		return nil, false
+	}
+	locales, ok := ctx.Value(localeKey{}).([]string)
+	return locales, ok && len(locales) > 0
+}
+
+// ParseAcceptLanguage returns the locales of an Accept-Language header ordered by quality,
+// e.g. "en-US,en;q=0.9,zh;q=0.8" => [en-us en zh].
+func ParseAcceptLanguage(header string) []string {
+	type tag struct {
+		locale  string
+		quality float64
+	}
+	var tags []tag
+	for _, part := range strings.Split(header, ",") {
+		fields := strings.Split(strings.TrimSpace(part), ";")
+		locale := normalizeLocale(fields[0])
+		if locale == "" || locale == "*" {
+			continue
+		}
+		quality := 1.0
+		for _, f := range fields[1:] {
+			f = strings.TrimSpace(f)
+			if strings.HasPrefix(f, "q=") {
+				if q, err := strconv.ParseFloat(f[2:], 64); err == nil {
+					quality = q
+				}
+			}
+		}
+		if quality > 0 {
+			tags = append(tags, tag{locale: locale, quality: quality})
+		}
+	}
+	sort.SliceStable(tags, func(i, j int) bool {
+		return tags[i].quality > tags[j].quality
+	})
+	locales := make([]string, 0, len(tags))
+	for _, t := range tags {
+		locales = append(locales, t.locale)
+	}
+	return locales
+}
+
+// Localize returns err with the reason rendered in the locale carried by ctx.
+// Messages appended by WithMessage are kept, the items of a BatchError are
+// rendered too, and an errorx wrapped with %w stays wrapped by the same chain.
+// Errors that are not *Error or have no message in the locale are returned unchanged.
+func Localize(ctx context.Context, err error) error {
+	locales, ok := LocaleFromContext(ctx)
+	if !ok {
+		return err
+	}
+	if be := new(BatchError); errors.As(err, &be) {
+		localized := be.localize(locales)
+		if err == error(be) {
+			return localized
+		}
+		return &localizedError{err: err, from: be, to: localized, se: localized.status, batch: localized}
+	}
+	se := new(Error)
+	if !errors.As(err, &se) {
+		return err
+	}
+	localized, ok := localize(se, locales)
+	if !ok {
+		return err
+	}
+	if err == error(se) {
+		return localized
+	}
+	return &localizedError{err: err, from: se, to: localized, se: localized}
+}
+
+// localize returns a copy of se with the reason in the first of the locales with a message.
+func localize(se *Error, locales []string) (*Error, bool) {
+	for _, locale := range locales {
+		reason, ok := Message(locale, int(se.StatusCode))
+		if !ok {
+			continue
+		}
+		localized := Clone(se)
+		localized.StatusReason = reason
+		if def, ok := Lookup(int(se.StatusCode)); ok && strings.HasPrefix(se.StatusReason, def.Reason) {
+			localized.StatusReason += strings.TrimPrefix(se.StatusReason, def.Reason)
+		}
+		return localized, true
+	}
+	return se, false
+}
+
+// localize returns a copy of the batch with the status and the items localized.
+func (b *BatchError) localize(locales []string) *BatchError {
+	status, _ := localize(b.status, locales)
+	items := b.Items()
+	for i, item := range items {
+		items[i].Err, _ = localize(item.Err, locales)
+	}
+	return &BatchError{status: status, items: items}
+}
+
+// localizedError is an error chain with its errorx localized: errors.As finds the
+// localized errorx, the other errors of the chain are still found by Unwrap.
+type localizedError struct {
+	err      error
+	from, to error
+	se       *Error
+	batch    *BatchError
+}
+
+func (e *localizedError) Error() string {
+	return strings.Replace(e.err.Error(), e.from.Error(), e.to.Error(), 1)
+}
+
+func (e *localizedError) Unwrap() error { return e.err }
+
+func (e *localizedError) As(target interface{}) bool {
+	switch t := target.(type) {
+	case **BatchError:
+		if e.batch != nil {
+			*t = e.batch
+			return true
+		}
+	case **Error:
+		*t = e.se
+		return true
+	}
+	return false
+}
+
+// GRPCStatus returns the status of the localized errorx.
+func (e *localizedError) GRPCStatus() *status.Status {
+	if e.batch != nil {
+		return e.batch.GRPCStatus()
+	}
+	return e.se.GRPCStatus()
+}
+
+// LocalizedReason returns the reason of err rendered in the locale carried by ctx.
+func LocalizedReason(ctx context.Context, err error) string {
+	return Reason(Localize(ctx, err))
+}
+
+func normalizeLocale(locale string) string {
+	return strings.ToLower(strings.ReplaceAll(strings.TrimSpace(locale), "_", "-"))
+}
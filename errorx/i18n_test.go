@@ -0,0 +1,68 @@
+package errorutil
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"reflect"
+	"testing"
+)
+
+func TestParseAcceptLanguage(t *testing.T) {
+	got := ParseAcceptLanguage("zh;q=0.8, en-US,en;q=0.9, *;q=0.1")
+	if want := []string{"en-us", "en", "zh"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("ParseAcceptLanguage() = %v, want %v", got, want)
+	}
+}
+
+func TestLocalize(t *testing.T) {
+	ctx := NewLocaleContext(context.Background(), ParseAcceptLanguage("en-US")...)
+	tests := []struct {
+		name string
+		ctx  context.Context
+		err  error
+		want string
+	}{
+		{"en", ctx, ErrSignatureError, "signature verification failed"},
+		{"message", ctx, ErrSignatureError.WithMessage("md5"), "signature verification failed:md5"},
+		{"no locale", context.Background(), ErrSignatureError, "签名验证错误"},
+		{"no message", NewLocaleContext(context.Background(), "fr"), ErrSignatureError, "签名验证错误"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := LocalizedReason(tt.ctx, tt.err); got != tt.want {
+				t.Errorf("LocalizedReason() = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestLocalizeWrapped(t *testing.T) {
+	ctx := NewLocaleContext(context.Background(), "en")
+
+	err := Localize(ctx, fmt.Errorf("query order: %w", ErrNotFound.WithCause(io.EOF)))
+	if got, want := err.Error(), "query order: record not found"; got != want {
+		t.Errorf("Error() = %s, want %s", got, want)
+	}
+	if !errors.Is(err, ErrNotFound) || !errors.Is(err, io.EOF) {
+		t.Errorf("Localize() lost the chain: %v", err)
+	}
+
+	batch := NewBatchError(nil)
+	batch.Add(1, ErrNotFound)
+	err = Localize(ctx, fmt.Errorf("import: %w", batch))
+	be := new(BatchError)
+	if !errors.As(err, &be) {
+		t.Fatalf("Localize() lost the batch: %v", err)
+	}
+	if got := Reason(be); got != "incorrect or incomplete information" {
+		t.Errorf("batch reason = %s", got)
+	}
+	if items := be.Items(); len(items) != 1 || items[0].Index != 1 || items[0].Err.StatusReason != "record not found" {
+		t.Errorf("batch items = %+v", items)
+	}
+	if batch.Items()[0].Err.StatusReason != "未找到对应记录" {
+		t.Error("Localize() changed the original batch")
+	}
+}
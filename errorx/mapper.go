@@ -0,0 +1,104 @@
+package errorutil
+
+import (
+	"errors"
+	"reflect"
+	"sync"
+)
+
+// Mapper maps errors to errorx errors with an ordered chain of rules,
+// the first matching rule wins. It is safe for concurrent use.
+type Mapper struct {
+	rules    []mapperRule
+	fallback *Error
+	mu       sync.RWMutex
+}
+
+type mapperRule struct {
+	match func(error) bool
+	to    *Error
+}
+
+// MapperOption is mapper option.
+type MapperOption func(*Mapper)
+
+// WithFallback with the errorx returned when no rule matches.
+func WithFallback(fallback *Error) MapperOption {
+	return func(m *Mapper) {
+		m.fallback = fallback
+	}
+}
+
+// NewMapper news a mapper, the default fallback is UnknownCode.
+func NewMapper(opts ...MapperOption) *Mapper {
+	m := &Mapper{
+		fallback: New(UnknownCode, UnknownReason, false),
+	}
+	for _, o := range opts {
+		o(m)
+	}
+	return m
+}
+
+// Is maps errors matching target with errors.Is to the errorx.
+func (m *Mapper) Is(target error, to *Error) *Mapper {
+	return m.When(func(err error) bool {
+		return errors.Is(err, target)
+	}, to)
+}
+
+// As maps errors matching the type of target with errors.As to the errorx,
+// target is a pointer to the error type, e.g. new(*os.PathError).
+func (m *Mapper) As(target interface{}, to *Error) *Mapper {
+	typ := reflect.TypeOf(target)
+	if typ == nil || typ.Kind() != reflect.Ptr {
+		panic("errorx: mapper target must be a non-nil pointer")
+	}
+	return m.When(func(err error) bool {
+		return errors.As(err, reflect.New(typ.Elem()).Interface())
+	}, to)
+}
+
+// When maps errors matching the predicate to the errorx,
+// e.g. all timeouts to a timeout code.
+func (m *Mapper) When(match func(error) bool, to *Error) *Mapper {
+	m.mu.Lock()
+	m.rules = append(m.rules, mapperRule{match: match, to: to})
+	m.mu.Unlock()
+	return m
+}
+
+// Reset deletes all rules.
+func (m *Mapper) Reset() {
+	m.mu.Lock()
+	m.rules = nil
+	m.mu.Unlock()
+}
+
+// Error returns the errorx of err caused by err, it returns nil for a nil error.
+// Errors matching no rule keep their own errorx or else get the fallback.
+func (m *Mapper) Error(err error) *Error {
+	if err == nil {
+		return nil
+	}
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	for _, r := range m.rules {
+		if r.match(err) {
+			return r.to.WithCause(err)
+		}
+	}
+	if se := new(Error); errors.As(err, &se) {
+		return se
+	}
+	return m.fallback.WithCause(err)
+}
+
+// Code returns the status code and message of err,
+// SuccessCode and SuccessMsg for a nil error.
+func (m *Mapper) Code(err error) (int32, string) {
+	if err == nil {
+		return SuccessCode, SuccessMsg
+	}
+	return m.Error(err).StatusCode, err.Error()
+}
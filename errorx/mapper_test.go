@@ -0,0 +1,60 @@
+package errorutil
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"testing"
+)
+
+func TestMapper(t *testing.T) {
+	errNoUser := errors.New("no user")
+	m := NewMapper().
+		Is(errNoUser, ErrNotFound).
+		As(new(*os.PathError), ErrDataError).
+		When(func(err error) bool { return errors.Is(err, context.DeadlineExceeded) }, ErrInternalError)
+
+	tests := []struct {
+		name string
+		err  error
+		want int32
+	}{
+		{"nil", nil, SuccessCode},
+		{"is", fmt.Errorf("query: %w", errNoUser), ErrNotFound.StatusCode},
+		{"as", &os.PathError{Op: "open", Path: "/x", Err: os.ErrNotExist}, ErrDataError.StatusCode},
+		{"predicate", fmt.Errorf("call: %w", context.DeadlineExceeded), ErrInternalError.StatusCode},
+		{"errorx", ErrIllegaUser, ErrIllegaUser.StatusCode},
+		{"fallback", errors.New("boom"), UnknownCode},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got, _ := m.Code(tt.err); got != tt.want {
+				t.Errorf("Code() = %d, want %d", got, tt.want)
+			}
+		})
+	}
+	if err := m.Error(errNoUser); !errors.Is(err, errNoUser) {
+		t.Errorf("Error() lost the cause: %+v", err)
+	}
+}
+
+func TestSetErrMap(t *testing.T) {
+	t.Cleanup(DefaultMapper.Reset)
+	errNoUser := errors.New("no user")
+	errNoOrder := errors.New("no order")
+	// matches both targets, the lower code wins on every run
+	err := bothErr{errNoUser, errNoOrder}
+	for i := 0; i < 20; i++ {
+		SetErrMap(map[error]int32{errNoUser: 20002, errNoOrder: 20001})
+		if got, _ := ErrCode(err); got != 20001 {
+			t.Fatalf("ErrCode() = %d, want 20001", got)
+		}
+	}
+}
+
+type bothErr [2]error
+
+func (e bothErr) Error() string { return e[0].Error() + ": " + e[1].Error() }
+
+func (e bothErr) Is(target error) bool { return target == e[0] || target == e[1] }
@@ -0,0 +1,203 @@
+package errorutil
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"sync"
+
+	"google.golang.org/grpc/codes"
+)
+
+// Definition describes a registered errorx code.
+type Definition struct {
+	Code        int    `json:"statusCode"`
+	Reason      string `json:"statusReason"`
+	Namespace   string `json:"namespace,omitempty"`
+	Description string `json:"description,omitempty"`
+	// Reasons is the localized reasons keyed by locale.
+	Reasons map[string]string `json:"reasons,omitempty"`
+	// HTTPStatus and GRPCCode are the transport statuses of the code.
+	HTTPStatus int        `json:"httpStatus,omitempty"`
+	GRPCCode   codes.Code `json:"grpcCode,omitempty"`
+	// Class is the classification flags of the code.
+	Class Class `json:"class,omitempty"`
+}
+
+// Option is errorx definition option.
+type Option func(*Definition)
+
+// WithDescription with the description shown in the catalog.
+func WithDescription(desc string) Option {
+	return func(d *Definition) {
+		d.Description = desc
+	}
+}
+
+// Namespace is a code range reserved by one service.
+type Namespace struct {
+	Name string `json:"name"`
+	Min  int    `json:"min"`
+	Max  int    `json:"max"`
+}
+
+type registry struct {
+	defs       map[int]*Definition
+	namespaces map[string]*Namespace
+	sync.RWMutex
+}
+
+var defaultRegistry = &registry{
+	defs:       make(map[int]*Definition),
+	namespaces: make(map[string]*Namespace),
+}
+
+// RegisterNamespace reserves the code range [min, max] for the named service.
+// It panics if the name is taken or the range overlaps another namespace.
+func RegisterNamespace(name string, min, max int) *Namespace {
+	if name == "" || min > max {
+		panic(fmt.Sprintf("errorx: invalid namespace %q [%d, %d]", name, min, max))
+	}
+	r := defaultRegistry
+	r.Lock()
+	defer r.Unlock()
+	if _, ok := r.namespaces[name]; ok {
+		panic(fmt.Sprintf("errorx: namespace %q already registered", name))
+	}
+	for _, ns := range r.namespaces {
+		if min <= ns.Max && ns.Min <= max {
+			panic(fmt.Sprintf("errorx: namespace %q [%d, %d] overlaps %q [%d, %d]", name, min, max, ns.Name, ns.Min, ns.Max))
+		}
+	}
+	for code, def := range r.defs {
+		if code >= min && code <= max && def.Namespace != name {
+			panic(fmt.Sprintf("errorx: namespace %q [%d, %d] contains code %d registered outside it", name, min, max, code))
+		}
+	}
+	ns := &Namespace{Name: name, Min: min, Max: max}
+	r.namespaces[name] = ns
+	return ns
+}
+
+// Register registers the code in the namespace and returns its sentinel errorx.
+// It panics if the code is out of the namespace range or already registered.
+func (n *Namespace) Register(code int, reason string, opts ...Option) *Error {
+	if code < n.Min || code > n.Max {
+		panic(fmt.Sprintf("errorx: code %d out of namespace %q [%d, %d]", code, n.Name, n.Min, n.Max))
+	}
+	return defaultRegistry.register(n.Name, code, reason, opts)
+}
+
+// Register registers the code and returns its sentinel errorx.
+// It panics if the code is already registered or reserved by a namespace,
+// use it from package level var blocks so collisions fail at init.
+func Register(code int, reason string, opts ...Option) *Error {
+	return defaultRegistry.register("", code, reason, opts)
+}
+
+func (r *registry) register(namespace string, code int, reason string, opts []Option) *Error {
+	def := &Definition{
+		Code:      code,
+		Reason:    reason,
+		Namespace: namespace,
+	}
+	for _, o := range opts {
+		o(def)
+	}
+
+	r.Lock()
+	if old, ok := r.defs[code]; ok {
+		r.Unlock()
+		panic(fmt.Sprintf("errorx: code %d (%s) already registered as %q in namespace %q", code, reason, old.Reason, old.Namespace))
+	}
+	if namespace == "" {
+		for _, ns := range r.namespaces {
+			if code >= ns.Min && code <= ns.Max {
+				r.Unlock()
+				panic(fmt.Sprintf("errorx: code %d is reserved by namespace %q", code, ns.Name))
+			}
+		}
+	}
+	r.defs[code] = def
+	r.Unlock()
+
+	for locale, msg := range def.Reasons {
+		RegisterMessages(locale, map[int]string{code: msg})
+	}
+	return New(code, reason, false)
+}
+
+// Lookup returns the definition of the registered code.
+func Lookup(code int) (Definition, bool) {
+	r := defaultRegistry
+	r.RLock()
+	defer r.RUnlock()
+	def, ok := r.defs[code]
+	if !ok {
+		return Definition{}, false
+	}
+	return *def, true
+}
+
+// Catalog returns all registered definitions ordered by code.
+func Catalog() []Definition {
+	r := defaultRegistry
+	r.RLock()
+	defs := make([]Definition, 0, len(r.defs))
+	for _, def := range r.defs {
+		defs = append(defs, *def)
+	}
+	r.RUnlock()
+	sort.Slice(defs, func(i, j int) bool {
+		return defs[i].Code < defs[j].Code
+	})
+	return defs
+}
+
+// CatalogJSON returns the catalog encoded as json.
+func CatalogJSON() ([]byte, error) {
+	return json.MarshalIndent(Catalog(), "", "  ")
+}
+
+// WriteCatalogMarkdown writes the catalog as a markdown table.
+func WriteCatalogMarkdown(w io.Writer) error {
+	return WriteMarkdown(w, Catalog())
+}
+
+// WriteMarkdown writes the definitions as a markdown table, e.g. the codes of one service.
+func WriteMarkdown(w io.Writer, defs []Definition) error {
+	var locales []string
+	seen := make(map[string]struct{})
+	for _, def := range defs {
+		for locale := range def.Reasons {
+			if _, ok := seen[locale]; !ok {
+				seen[locale] = struct{}{}
+				locales = append(locales, locale)
+			}
+		}
+	}
+	sort.Strings(locales)
+
+	var b strings.Builder
+	b.WriteString("| StatusCode | Namespace | HTTP | gRPC | Class | StatusReason |")
+	for _, locale := range locales {
+		b.WriteString(" StatusReason(" + locale + ") |")
+	}
+	b.WriteString(" Description |\n|" + strings.Repeat(" --- |", len(locales)+7) + "\n")
+	for _, def := range defs {
+		httpStatus, grpcCode := def.transportStatus()
+		fmt.Fprintf(&b, "| %d | %s | %d | %s | %s | %s |", def.Code, def.Namespace, httpStatus, grpcCode, def.class(), escapeMarkdown(def.Reason))
+		for _, locale := range locales {
+			b.WriteString(" " + escapeMarkdown(def.Reasons[locale]) + " |")
+		}
+		b.WriteString(" " + escapeMarkdown(def.Description) + " |\n")
+	}
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+func escapeMarkdown(s string) string {
+	return strings.NewReplacer("|", "\\|", "\n", " ").Replace(s)
+}
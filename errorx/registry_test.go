@@ -0,0 +1,59 @@
+package errorutil
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func mustPanic(t *testing.T, name string, f func()) {
+	t.Helper()
+	defer func() {
+		if recover() == nil {
+			t.Errorf("%s: expected panic", name)
+		}
+	}()
+	f()
+}
+
+// unregister removes the namespace and its codes from the global registry, so the
+// tests registering into it can run again with -count.
+func unregister(t *testing.T, name string) {
+	t.Cleanup(func() {
+		r := defaultRegistry
+		r.Lock()
+		defer r.Unlock()
+		for code, def := range r.defs {
+			if def.Namespace == name {
+				delete(r.defs, code)
+			}
+		}
+		delete(r.namespaces, name)
+	})
+}
+
+func TestRegister(t *testing.T) {
+	unregister(t, "registry_test")
+	ns := RegisterNamespace("registry_test", 90000, 90099)
+	err := ns.Register(90001, "测试错误", WithDescription("test only"))
+	if err.StatusCode != 90001 || err.StatusReason != "测试错误" {
+		t.Fatalf("Register() = %v", err)
+	}
+	if def, ok := Lookup(90001); !ok || def.Namespace != "registry_test" {
+		t.Errorf("Lookup() = %+v, %v", def, ok)
+	}
+
+	mustPanic(t, "duplicate code", func() { Register(102, "重复") })
+	mustPanic(t, "duplicate in namespace", func() { ns.Register(90001, "重复") })
+	mustPanic(t, "out of range", func() { ns.Register(91000, "越界") })
+	mustPanic(t, "reserved", func() { Register(90002, "保留") })
+	mustPanic(t, "overlap", func() { RegisterNamespace("overlap", 90050, 90150) })
+
+	var buf bytes.Buffer
+	if err := WriteCatalogMarkdown(&buf); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(buf.String(), "| 90001 | registry_test | 500 | Unknown | server_fault | 测试错误 |") {
+		t.Errorf("markdown catalog missing 90001:\n%s", buf.String())
+	}
+}
@@ -0,0 +1,169 @@
+package errorutil
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+
+	httpstatus "github.com/go-kratos/kratos/v2/transport/http/status"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/types/known/anypb"
+)
+
+// ErrorDomain is the grpc ErrorInfo domain of errorx errors,
+// the ErrorInfo reason carries the StatusCode.
+const ErrorDomain = "errorx"
+
+// WithHTTPStatus with the http status the code is transported as.
+// If only the grpc code is declared the http status is derived from it.
+func WithHTTPStatus(httpStatus int) Option {
+	return func(d *Definition) {
+		d.HTTPStatus = httpStatus
+	}
+}
+
+// WithGRPCCode with the grpc code the code is transported as.
+// If only the http status is declared the grpc code is derived from it.
+func WithGRPCCode(code codes.Code) Option {
+	return func(d *Definition) {
+		d.GRPCCode = code
+	}
+}
+
+// MapStatus overrides the transport statuses of a registered code.
+// It panics if the code is not registered.
+func MapStatus(code, httpStatus int, grpcCode codes.Code) {
+	r := defaultRegistry
+	r.Lock()
+	defer r.Unlock()
+	def, ok := r.defs[code]
+	if !ok {
+		panic(fmt.Sprintf("errorx: code %d is not registered", code))
+	}
+	def.HTTPStatus = httpStatus
+	def.GRPCCode = grpcCode
+}
+
+// HTTPStatus returns the http status for an errorx.
+// It supports wrapped errors.
+func HTTPStatus(err error) int {
+	if err == nil {
+		return http.StatusOK
+	}
+	httpStatus, _ := transportStatus(FromError(err).StatusCode)
+	return httpStatus
+}
+
+// GRPCCode returns the grpc code for an errorx.
+// It supports wrapped errors.
+func GRPCCode(err error) codes.Code {
+	if err == nil {
+		return codes.OK
+	}
+	_, code := transportStatus(FromError(err).StatusCode)
+	return code
+}
+
+// FromGRPCStatus converts a grpc status to *Error, it returns nil for an OK status.
+// The StatusCode is restored from the errorx ErrorInfo detail,
+// or else mapped from the grpc code, the other details are kept.
+func FromGRPCStatus(s *status.Status) *Error {
+	if s == nil || s.Code() == codes.OK {
+		return nil
+	}
+	var (
+		se      *Error
+		details []*anypb.Any
+	)
+	for _, detail := range s.Proto().Details {
+		info := new(errdetails.ErrorInfo)
+		if se == nil && detail.MessageIs(info) && detail.UnmarshalTo(info) == nil && info.Domain == ErrorDomain {
+			if code, err := strconv.Atoi(info.Reason); err == nil {
+				se = New(code, s.Message(), false).WithMetadata(info.Metadata)
+				continue
+			}
+		}
+		details = append(details, detail)
+	}
+	if se == nil {
+		se = New(codeFromTransport(func(def Definition) bool {
+			_, code := def.transportStatus()
+			return code == s.Code()
+		}), s.Message(), false)
+	}
+	se.Status.Details = details
+	return se
+}
+
+// FromHTTPResponse converts an http response to *Error, it returns nil for a success response.
+// The StatusCode is read from the statusCode/statusReason body,
+// or else mapped from the http status. The body is restored for the caller.
+func FromHTTPResponse(resp *http.Response) *Error {
+	if resp == nil {
+		return nil
+	}
+	var body []byte
+	if resp.Body != nil {
+		body, _ = io.ReadAll(resp.Body)
+		resp.Body.Close()
+		resp.Body = io.NopCloser(bytes.NewReader(body))
+	}
+	var s struct {
+		StatusCode   *int32            `json:"statusCode"`
+		StatusReason string            `json:"statusReason"`
+		Metadata     map[string]string `json:"metadata"`
+	}
+	if err := json.Unmarshal(body, &s); err == nil && s.StatusCode != nil {
+		if *s.StatusCode == SuccessCode || *s.StatusCode == ReceiveSuccessCode {
+			return nil
+		}
+		se := New(int(*s.StatusCode), s.StatusReason, false).WithMetadata(s.Metadata)
+		if st := new(Status); (protojson.UnmarshalOptions{DiscardUnknown: true}).Unmarshal(body, st) == nil {
+			se.Status.Details = st.Details
+		}
+		return se
+	}
+	if resp.StatusCode >= http.StatusOK && resp.StatusCode < http.StatusMultipleChoices {
+		return nil
+	}
+	return New(codeFromTransport(func(def Definition) bool {
+		httpStatus, _ := def.transportStatus()
+		return httpStatus == resp.StatusCode
+	}), http.StatusText(resp.StatusCode), false)
+}
+
+func transportStatus(code int32) (int, codes.Code) {
+	if code == SuccessCode || code == ReceiveSuccessCode {
+		return http.StatusOK, codes.OK
+	}
+	def, _ := Lookup(int(code))
+	return def.transportStatus()
+}
+
+func (d Definition) transportStatus() (int, codes.Code) {
+	switch {
+	case d.HTTPStatus == 0 && d.GRPCCode == codes.OK:
+		return http.StatusInternalServerError, codes.Unknown
+	case d.HTTPStatus == 0:
+		return httpstatus.FromGRPCCode(d.GRPCCode), d.GRPCCode
+	case d.GRPCCode == codes.OK:
+		return d.HTTPStatus, httpstatus.ToGRPCCode(d.HTTPStatus)
+	}
+	return d.HTTPStatus, d.GRPCCode
+}
+
+// codeFromTransport returns the lowest registered code matching the transport status.
+func codeFromTransport(match func(Definition) bool) int {
+	for _, def := range Catalog() {
+		if (def.HTTPStatus != 0 || def.GRPCCode != codes.OK) && match(def) {
+			return def.Code
+		}
+	}
+	return UnknownCode
+}
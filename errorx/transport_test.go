@@ -0,0 +1,61 @@
+package errorutil
+
+import (
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestTransportStatus(t *testing.T) {
+	tests := []struct {
+		err      error
+		http     int
+		grpcCode codes.Code
+	}{
+		{ErrSignatureError, http.StatusUnauthorized, codes.Unauthenticated},
+		{ErrIllegaUser.WithMessage("a"), http.StatusForbidden, codes.PermissionDenied},
+		{ErrInternalError, http.StatusInternalServerError, codes.Internal},
+		{New(99999, "unregistered", false), http.StatusInternalServerError, codes.Unknown},
+		{nil, http.StatusOK, codes.OK},
+	}
+	for _, tt := range tests {
+		if got := HTTPStatus(tt.err); got != tt.http {
+			t.Errorf("HTTPStatus(%v) = %d, want %d", tt.err, got, tt.http)
+		}
+		if got := GRPCCode(tt.err); got != tt.grpcCode {
+			t.Errorf("GRPCCode(%v) = %s, want %s", tt.err, got, tt.grpcCode)
+		}
+	}
+}
+
+func TestFromGRPCStatus(t *testing.T) {
+	err := ErrNotFound.WithMetadata(map[string]string{"id": "1"})
+	se := FromGRPCStatus(status.Convert(err))
+	if se.StatusCode != 109 || se.StatusReason != ErrNotFound.StatusReason || se.Metadata["id"] != "1" {
+		t.Errorf("FromGRPCStatus() = %+v", se)
+	}
+	if se := FromGRPCStatus(status.New(codes.PermissionDenied, "denied")); se.StatusCode != 103 {
+		t.Errorf("FromGRPCStatus() code = %d, want 103", se.StatusCode)
+	}
+}
+
+func TestFromHTTPResponse(t *testing.T) {
+	resp := &http.Response{
+		StatusCode: http.StatusOK,
+		Body:       io.NopCloser(strings.NewReader(`{"statusCode":102,"statusReason":"签名验证错误"}`)),
+	}
+	if se := FromHTTPResponse(resp); se == nil || se.StatusCode != 102 {
+		t.Errorf("FromHTTPResponse() = %v", se)
+	}
+	if body, _ := io.ReadAll(resp.Body); len(body) == 0 {
+		t.Error("FromHTTPResponse() did not restore the body")
+	}
+	resp = &http.Response{StatusCode: http.StatusNotFound, Body: io.NopCloser(strings.NewReader("not found"))}
+	if se := FromHTTPResponse(resp); se == nil || se.StatusCode != 109 {
+		t.Errorf("FromHTTPResponse() = %v", se)
+	}
+}
@@ -1,15 +1,22 @@
 module github.com/XuThreeFire/goutil
 
-go 1.17
+go 1.21
+
+require (
+	github.com/go-kratos/kratos/v2 v2.5.0
+	github.com/lestrrat-go/file-rotatelogs v2.4.0+incompatible
+	go.uber.org/zap v1.23.0
+	gopkg.in/natefinch/lumberjack.v2 v2.2.1
+)
 
 require (
 	github.com/go-kit/kit v0.12.0 // indirect
-	github.com/go-kratos/kratos/v2 v2.5.0 // indirect
 	github.com/go-playground/form/v4 v4.2.0 // indirect
 	github.com/google/uuid v1.3.0 // indirect
+	github.com/lestrrat-go/strftime v1.2.0 // indirect
+	github.com/pkg/errors v0.9.1 // indirect
 	go.uber.org/atomic v1.9.0 // indirect
 	go.uber.org/multierr v1.7.0 // indirect
-	go.uber.org/zap v1.23.0 // indirect
 	golang.org/x/sync v0.0.0-20220513210516-0976fa681c29 // indirect
 	google.golang.org/protobuf v1.28.0 // indirect
 	gopkg.in/yaml.v3 v3.0.1 // indirect
@@ -2,14 +2,12 @@ package goutil
 
 import "fmt"
 
-// Go is a basic promise implementation: it wraps calls a function in a goroutine
-// and returns a channel which will later return the function's return value.
+// Go calls the function and returns its error, a panic is returned as
+// errorx.ErrInternalError with the stack.
+//
+// Deprecated: it blocks until f returns, use Safe, or a Group for concurrency.
 func Go(f func() error) error {
-	ch := make(chan error)
-	go func() {
-		ch <- f()
-	}()
-	return <-ch
+	return Safe(f)
 }
 
 // PanicIfErr if errorx is not empty, will panic
@@ -0,0 +1,118 @@
+package goutil
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	errorutil "github.com/XuThreeFire/goutil/errorx"
+)
+
+// Group is a collection of goroutines working on subtasks of a common task.
+// Panics in a goroutine are recovered and returned as errorx.ErrInternalError with the stack.
+// A zero Group is valid, has no limit and does not cancel on error.
+type Group struct {
+	cancel  func()
+	sem     chan struct{}
+	collect bool
+
+	wg      sync.WaitGroup
+	errOnce sync.Once
+	err     error
+	mu      sync.Mutex
+	errs    []error
+}
+
+// GroupOption is group option.
+type GroupOption func(*Group)
+
+// WithLimit with the max number of active goroutines, Go blocks until one exits.
+func WithLimit(n int) GroupOption {
+	return func(g *Group) {
+		if n > 0 {
+			g.sem = make(chan struct{}, n)
+		}
+	}
+}
+
+// WithCollectErrors does not cancel the context on the first error,
+// so every goroutine runs and Errors returns all errors.
+func WithCollectErrors() GroupOption {
+	return func(g *Group) {
+		g.collect = true
+	}
+}
+
+// NewGroup returns a new Group and an associated Context derived from ctx.
+// The derived Context is canceled the first time a function passed to Go
+// returns a non-nil error or Wait returns, whichever occurs first.
+func NewGroup(ctx context.Context, opts ...GroupOption) (*Group, context.Context) {
+	ctx, cancel := context.WithCancel(ctx)
+	g := &Group{cancel: cancel}
+	for _, o := range opts {
+		o(g)
+	}
+	return g, ctx
+}
+
+// Go calls the given function in a new goroutine.
+func (g *Group) Go(f func() error) {
+	if g.sem != nil {
+		g.sem <- struct{}{}
+	}
+	g.wg.Add(1)
+	go func() {
+		defer func() {
+			if g.sem != nil {
+				<-g.sem
+			}
+			g.wg.Done()
+		}()
+		if err := Safe(f); err != nil {
+			g.fail(err)
+		}
+	}()
+}
+
+// Wait blocks until all function calls from the Go method have returned,
+// then returns the first non-nil error (if any) from them.
+func (g *Group) Wait() error {
+	g.wg.Wait()
+	if g.cancel != nil {
+		g.cancel()
+	}
+	return g.err
+}
+
+// Errors returns all non-nil errors returned by the functions, in the order they failed.
+func (g *Group) Errors() []error {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return append([]error(nil), g.errs...)
+}
+
+func (g *Group) fail(err error) {
+	g.mu.Lock()
+	g.errs = append(g.errs, err)
+	g.mu.Unlock()
+	g.errOnce.Do(func() {
+		g.err = err
+		if g.cancel != nil && !g.collect {
+			g.cancel()
+		}
+	})
+}
+
+// Safe calls f and converts a panic into errorx.ErrInternalError with the stack.
+func Safe(f func() error) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			se := errorutil.ErrInternalError.WithMessage(fmt.Sprintf("panic: %v", r))
+			if cause, ok := r.(error); ok {
+				se = se.WithCause(cause)
+			}
+			err = se.WithStack()
+		}
+	}()
+	return f()
+}
@@ -0,0 +1,61 @@
+package goutil
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	errorutil "github.com/XuThreeFire/goutil/errorx"
+)
+
+func TestGroupPanic(t *testing.T) {
+	g, ctx := NewGroup(context.Background())
+	g.Go(func() error {
+		panic("boom")
+	})
+	g.Go(func() error {
+		<-ctx.Done()
+		return ctx.Err()
+	})
+	err := g.Wait()
+	if !errors.Is(err, errorutil.ErrInternalError) {
+		t.Fatalf("Wait() = %v, want ErrInternalError", err)
+	}
+	if got := fmt.Sprintf("%+v", err); !strings.Contains(got, "panic: boom") || !strings.Contains(got, "TestGroupPanic") {
+		t.Errorf("%%+v missing the panic or stack:\n%s", got)
+	}
+}
+
+func TestGroupLimit(t *testing.T) {
+	var active, max int32
+	g, _ := NewGroup(context.Background(), WithLimit(2), WithCollectErrors())
+	for i := 0; i < 6; i++ {
+		i := i
+		g.Go(func() error {
+			n := atomic.AddInt32(&active, 1)
+			for {
+				m := atomic.LoadInt32(&max)
+				if n <= m || atomic.CompareAndSwapInt32(&max, m, n) {
+					break
+				}
+			}
+			time.Sleep(10 * time.Millisecond)
+			atomic.AddInt32(&active, -1)
+			if i%2 == 0 {
+				return fmt.Errorf("task %d", i)
+			}
+			return nil
+		})
+	}
+	g.Wait()
+	if max > 2 {
+		t.Errorf("max active = %d, want <= 2", max)
+	}
+	if n := len(g.Errors()); n != 3 {
+		t.Errorf("len(Errors()) = %d, want 3", n)
+	}
+}
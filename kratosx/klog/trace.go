@@ -3,11 +3,14 @@ package klog
 import (
 	"context"
 
+	traceutil "github.com/XuThreeFire/goutil/tracex"
+
 	"github.com/go-kratos/kratos/v2/log"
 	"github.com/go-kratos/kratos/v2/transport"
 )
 
-type TraceIDKey struct{}
+// TraceIDKey is the context key of the trace id, shared with the go-kit middlewares.
+type TraceIDKey = traceutil.TraceIDKey
 
 // TraceID returns a trace_id valuer.
 func TraceID() log.Valuer {
@@ -18,7 +21,7 @@ func TraceID() log.Valuer {
 					return traceID
 				}
 			}
-			if traceID, ok := ctx.Value(TraceIDKey{}).(string); ok {
+			if traceID, ok := traceutil.TraceIDFromContext(ctx); ok {
 				return traceID
 			}
 		}
@@ -2,20 +2,19 @@ package kmid
 
 import (
 	"context"
-	"crypto/md5"
-	"encoding/hex"
 	"errors"
-	"io"
+	nethttp "net/http"
 	"strings"
 
+	authutil "github.com/XuThreeFire/goutil/authx"
 	ecode "github.com/XuThreeFire/goutil/errorx"
-	klog "github.com/XuThreeFire/goutil/kratosx/klog"
 	time_parse "github.com/XuThreeFire/goutil/timex"
 
 	"github.com/go-kratos/kratos/v2/middleware"
 	"github.com/go-kratos/kratos/v2/transport"
 	"github.com/go-kratos/kratos/v2/transport/http"
 	"github.com/google/uuid"
+	"google.golang.org/grpc/peer"
 )
 
 type validator interface {
@@ -30,18 +29,60 @@ type SignInfo struct {
 	Timestamp string
 	Body      []byte
 	Key       string
+	// Alg is the signature algorithm, md5 if empty.
+	Alg string
+	// Nonce is signed after the timestamp, empty for legacy requests.
+	Nonce string
 }
 
+// CalculateSign returns the signature of the sign info, md5 for an unknown Alg.
 func (s *SignInfo) CalculateSign() string {
-	signData := []byte(s.User + s.Method + s.Timestamp)
-	signData = append(signData, s.Body...)
-	signData = append(signData, []byte(s.Key)...)
-	md5Bytes := md5.Sum(signData)
-	return strings.ToLower(hex.EncodeToString(md5Bytes[:]))
+	signer, ok := authutil.GetSigner(s.Alg)
+	if !ok {
+		signer, _ = authutil.GetSigner(authutil.AlgMD5)
+	}
+	r := &authutil.Request{User: s.User, Method: s.Method, Timestamp: s.Timestamp, Nonce: s.Nonce, Alg: signer.Alg(), Body: s.Body}
+	return signer.Sign(r.Data(), s.Key)
+}
+
+// AuthBodyFilter reads the raw body of the signed requests before kratos decodes it,
+// so AuthHttp verifies the signature on the exact bytes, register it with http.Filter
+// and pass it the same WithMaxBodySize. The body is rewound for the decoder.
+// In the hash-of-body mode, for large and multipart uploads, the body is not buffered in
+// memory but hashed while it is spooled to a temporary file, at most WithMaxHashedBodySize,
+// and rejected before the handler if it does not match the Body-Hash header. The trade-off
+// is the disk space and the time to receive the whole body before the handler starts.
+func AuthBodyFilter(opts ...authutil.Option) http.FilterFunc {
+	o := authutil.NewOptions(opts...)
+	return func(next nethttp.Handler) nethttp.Handler {
+		return nethttp.HandlerFunc(func(w nethttp.ResponseWriter, r *nethttp.Request) {
+			if r.Header.Get(authutil.HeaderAuthUser) == "" {
+				next.ServeHTTP(w, r)
+				return
+			}
+			sr := &authutil.Request{}
+			if err := o.ReadBody(r, sr); err != nil {
+				ErrorEncoder(w, r, err)
+				return
+			}
+			if sr.BodyHash != "" {
+				defer r.Body.Close() // the spooled body
+				next.ServeHTTP(w, r.WithContext(authutil.NewBodyHashContext(r.Context(), sr.BodyHash)))
+				return
+			}
+			next.ServeHTTP(w, r.WithContext(authutil.NewBodyContext(r.Context(), sr.Body)))
+		})
+	}
 }
 
 // AuthHttp is the function type used for http custom validators.
-func AuthHttp(userMap map[string]struct{}, key, testSign string) middleware.Middleware {
+// The request is verified by authutil.Options.Verify, see the authutil options.
+// The body is read by authutil.Options.ReadBody, use AuthBodyFilter for the routes
+// whose body is decoded by kratos before the middlewares. A request in the hash-of-body
+// mode is rejected unless its body matched the Body-Hash header while it was read.
+// testSign is only accepted in the test mode, see authutil.WithTestSign, prefer WithTestMode.
+func AuthHttp(userMap map[string]struct{}, key, testSign string, opts ...authutil.Option) middleware.Middleware {
+	o := authutil.NewOptions(append([]authutil.Option{authutil.WithTestSign(testSign)}, opts...)...)
 	return func(handler middleware.Handler) middleware.Handler {
 		return func(ctx context.Context, req interface{}) (reply interface{}, err error) {
 			hc, ok := ctx.(http.Context)
@@ -50,38 +91,24 @@ func AuthHttp(userMap map[string]struct{}, key, testSign string) middleware.Midd
 			}
 
 			r := hc.Request()
-			bodyBytes, err := io.ReadAll(r.Body)
-			if err != nil {
-				return nil, ecode.ErrEmptyParam
-			}
-			// defer r.Body.Close()
 
 			// set trace_id
-			traceID := r.Header.Get("Trace-Id")
-			ctx = context.WithValue(ctx, klog.TraceIDKey{}, traceID)
-			hc.Response().Header().Set("Trace-Id", traceID)
-			authUser := r.Header.Get("Auth-User")
-			if _, isOk := userMap[authUser]; !isOk {
+			traceID := r.Header.Get(authutil.HeaderTraceID)
+			ctx = authutil.NewTraceContext(ctx, traceID)
+			hc.Response().Header().Set(authutil.HeaderTraceID, traceID)
+
+			sr := authutil.RequestFromHeader(r.Header.Get)
+			if _, isOk := userMap[sr.User]; !isOk {
 				return nil, ecode.ErrIllegaUser
 			}
-
-			method := r.Header.Get("Method")
-			timestamp := r.Header.Get("Timestamp")
-			signature := r.Header.Get("Signature")
-
-			s := SignInfo{
-				User:      authUser,
-				Method:    method,
-				Timestamp: timestamp,
-				Body:      bodyBytes,
-				Key:       key,
+			if err := o.ReadBody(r, sr); err != nil {
+				return nil, err
 			}
-			sign := s.CalculateSign()
-			if signature != sign {
-				if signature != testSign {
-					return nil, ecode.ErrSignatureError
-				}
+			sr.Addr = r.RemoteAddr
+			if err := o.Verify(ctx, sr, key); err != nil {
+				return nil, err
 			}
+			ctx = authutil.NewRequestContext(ctx, sr)
 
 			if v, ok := req.(validator); ok {
 				if err := v.Validate(); err != nil {
@@ -95,95 +122,186 @@ func AuthHttp(userMap map[string]struct{}, key, testSign string) middleware.Midd
 }
 
 // AuthGrpc is the function type used for grpc custom validators.
-func AuthGrpc(userMap map[string]struct{}, key, testSign string) middleware.Middleware {
+// The request is verified by authutil.Options.Verify, see the authutil options.
+// WithSignedPayload verifies the request message and the Method header against the operation,
+// the clients must sign with AuthGrpcClient and the same option.
+// Rejections are returned as errorx errors with their grpc codes, e.g. Unauthenticated for
+// a bad signature and PermissionDenied for an unknown user, WithLegacyReply returns them
+// as the reply for the old clients, except an unknown user which is still returned as the error.
+// testSign is only accepted in the test mode, see authutil.WithTestSign, prefer WithTestMode.
+func AuthGrpc(userMap map[string]struct{}, key, testSign string, opts ...authutil.Option) middleware.Middleware {
+	o := authutil.NewOptions(append([]authutil.Option{authutil.WithTestSign(testSign)}, opts...)...)
 	return func(handler middleware.Handler) middleware.Handler {
 		return func(ctx context.Context, req interface{}) (reply interface{}, err error) {
-			tr, ok := transport.FromServerContext(ctx)
-			if !ok {
-				return ecode.ErrInternalError, nil
+			if ctx, err = authGrpc(ctx, req, userMap, key, o); err != nil {
+				// an unknown user was returned as the error before the legacy mode too
+				if o.LegacyReply && !ecode.ErrIllegaUser.Is(err) {
+					return ecode.FromError(err), nil
+				}
+				return nil, err
 			}
+			return handler(ctx, req)
+		}
+	}
+}
 
-			// set trace_id
-			traceID := tr.RequestHeader().Get("Trace-Id")
-			ctx = context.WithValue(ctx, klog.TraceIDKey{}, traceID)
-			tr.ReplyHeader().Set("Trace-Id", traceID)
+func authGrpc(ctx context.Context, req interface{}, userMap map[string]struct{}, key string, o *authutil.Options) (context.Context, error) {
+	tr, ok := transport.FromServerContext(ctx)
+	if !ok {
+		return ctx, ecode.ErrInternalError
+	}
 
-			authUser := tr.RequestHeader().Get("Auth-User")
-			if _, isOk := userMap[authUser]; !isOk {
-				return nil, ecode.ErrIllegaUser
-			}
-			method := tr.RequestHeader().Get("Method")
-			timestamp := tr.RequestHeader().Get("Timestamp")
-			signature := tr.RequestHeader().Get("Signature")
-
-			s := SignInfo{
-				User:      authUser,
-				Method:    method,
-				Timestamp: timestamp,
-				Body:      nil,
-				Key:       key,
-			}
-			sign := s.CalculateSign()
-			if signature != sign {
-				if signature != testSign {
-					return ecode.ErrSignatureError, nil
-				}
-			}
+	// set trace_id
+	traceID := tr.RequestHeader().Get(authutil.HeaderTraceID)
+	ctx = authutil.NewTraceContext(ctx, traceID)
+	tr.ReplyHeader().Set(authutil.HeaderTraceID, traceID)
 
-			if v, ok := req.(validator); ok {
-				if err := v.Validate(); err != nil {
-					return ecode.ErrIllegalRequest, nil
-				}
-			}
+	sr := authutil.RequestFromHeader(tr.RequestHeader().Get)
+	if _, isOk := userMap[sr.User]; !isOk {
+		return ctx, ecode.ErrIllegaUser
+	}
+	sr.Addr = peerAddr(ctx)
+	if o.SignedPayload {
+		if sr.Method != operationMethod(tr.Operation()) {
+			return ctx, ecode.ErrSignatureError.WithMessage("method mismatch")
+		}
+		var err error
+		if sr.Body, err = authutil.PayloadBody(req); err != nil {
+			return ctx, err
+		}
+	}
+	if err := o.Verify(ctx, sr, key); err != nil {
+		return ctx, err
+	}
+	ctx = authutil.NewRequestContext(ctx, sr)
 
-			return handler(ctx, req)
+	if v, ok := req.(validator); ok {
+		if err := v.Validate(); err != nil {
+			return ctx, ecode.ErrIllegalRequest.WithCause(err)
 		}
 	}
+	return ctx, nil
 }
 
-func AuthHttpClient(user, key string) middleware.Middleware {
+// AuthHttpClient signs the client requests, the algorithm is sent in the Sign-Alg header
+// unless it is the legacy md5, so each upstream can be switched on its own.
+// WithNonce adds a signed Nonce header for upstreams with replay protection,
+// WithKeyProvider signs with the primary key of the user.
+func AuthHttpClient(user, key string, opts ...authutil.Option) middleware.Middleware {
+	o := authutil.NewOptions(opts...)
 	return func(handler middleware.Handler) middleware.Handler {
 		return func(ctx context.Context, req interface{}) (reply interface{}, err error) {
 			s, ok := ctx.Value(SignKey{}).(*SignInfo)
 			if !ok {
 				return nil, errors.New("sign info not found")
 			}
-			if tr, ok := transport.FromClientContext(ctx); ok {
+			tr, ok := transport.FromClientContext(ctx)
+			if !ok {
+				return handler(ctx, req)
+			}
+			traceID, ok := authutil.TraceIDFromContext(ctx)
+			if !ok {
+				traceID = uuid.NewString()
+				ctx = authutil.NewTraceContext(ctx, traceID)
+			}
+			if s.User == "" {
+				s.User = user
+			}
+			if s.Key == "" {
+				s.Key = key
+			}
+			sign := func() error {
+				sr := &authutil.Request{
+					User:      s.User,
+					Method:    operationMethod(tr.Operation()),
+					Timestamp: time_parse.GetTimeStamp(),
+					Body:      s.Body,
+				}
+				if err := o.Sign(ctx, sr, s.Key); err != nil {
+					return err
+				}
+				s.Method, s.Timestamp, s.Alg, s.Nonce = sr.Method, sr.Timestamp, sr.Alg, sr.Nonce
 				header := tr.RequestHeader()
+				sr.SetHeader(header.Set)
+				header.Set(authutil.HeaderTraceID, traceID)
+				return nil
+			}
+			if err := sign(); err != nil {
+				return nil, err
+			}
+			// a Retry after in the chain signs each attempt with a fresh timestamp and nonce
+			return handler(context.WithValue(ctx, resignKey{}, sign), req)
+		}
+	}
+}
 
-				traceID := func() string {
-					if traceID, ok := ctx.Value(klog.TraceIDKey{}).(string); ok {
-						return traceID
-					}
-					return uuid.NewString()
-				}()
-
-				method := func() string {
-					words := strings.Split(tr.Operation(), "/")
-					if len(words) > 0 {
-						return words[len(words)-1]
-					}
-					return "errorx method"
-				}()
-				tm := time_parse.GetTimeStamp()
-
-				if s.User == "" {
-					s.User = user
+// AuthGrpcClient signs the grpc client requests like AuthHttpClient, with the user and key
+// of the SignInfo in the context if any. WithSignedPayload signs the request message.
+func AuthGrpcClient(user, key string, opts ...authutil.Option) middleware.Middleware {
+	o := authutil.NewOptions(opts...)
+	o.ClientSigner() // panic on an unsupported algorithm when building the client
+	return func(handler middleware.Handler) middleware.Handler {
+		return func(ctx context.Context, req interface{}) (reply interface{}, err error) {
+			tr, ok := transport.FromClientContext(ctx)
+			if !ok {
+				return handler(ctx, req)
+			}
+			signUser, signKey := user, key
+			if s, ok := ctx.Value(SignKey{}).(*SignInfo); ok {
+				if s.User != "" {
+					signUser = s.User
 				}
-				if s.Key == "" {
-					s.Key = key
+				if s.Key != "" {
+					signKey = s.Key
 				}
-				s.Method = method
-				s.Timestamp = tm
-				sign := s.CalculateSign()
-
-				header.Set("Auth-User", user)
-				header.Set("Method", method)
-				header.Set("Timestamp", tm)
-				header.Set("Signature", sign)
-				header.Set("Trace-Id", traceID)
 			}
-			return handler(ctx, req)
+			var body []byte
+			if o.SignedPayload {
+				if body, err = authutil.PayloadBody(req); err != nil {
+					return nil, err
+				}
+			}
+			traceID, ok := authutil.TraceIDFromContext(ctx)
+			if !ok {
+				traceID = uuid.NewString()
+				ctx = authutil.NewTraceContext(ctx, traceID)
+			}
+			sign := func() error {
+				sr := &authutil.Request{
+					User:      signUser,
+					Method:    operationMethod(tr.Operation()),
+					Timestamp: time_parse.GetTimeStamp(),
+					Body:      body,
+				}
+				if err := o.Sign(ctx, sr, signKey); err != nil {
+					return err
+				}
+				header := tr.RequestHeader()
+				sr.SetHeader(header.Set)
+				header.Set(authutil.HeaderTraceID, traceID)
+				return nil
+			}
+			if err := sign(); err != nil {
+				return nil, err
+			}
+			// a Retry after in the chain signs each attempt with a fresh timestamp and nonce
+			return handler(context.WithValue(ctx, resignKey{}, sign), req)
 		}
 	}
 }
+
+// operationMethod returns the method name of the operation, e.g. "Query" of "/pkg.Service/Query".
+func operationMethod(operation string) string {
+	words := strings.Split(operation, "/")
+	if len(words) > 0 {
+		return words[len(words)-1]
+	}
+	return "errorx method"
+}
+
+func peerAddr(ctx context.Context) string {
+	if p, ok := peer.FromContext(ctx); ok && p.Addr != nil {
+		return p.Addr.String()
+	}
+	return ""
+}
@@ -0,0 +1,369 @@
+package kmid
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"strconv"
+	"testing"
+	"time"
+
+	authutil "github.com/XuThreeFire/goutil/authx"
+	errorutil "github.com/XuThreeFire/goutil/errorx"
+
+	"github.com/go-kratos/kratos/v2/encoding"
+	"github.com/go-kratos/kratos/v2/middleware"
+	"github.com/go-kratos/kratos/v2/transport"
+	"github.com/go-kratos/kratos/v2/transport/grpc"
+	"github.com/go-kratos/kratos/v2/transport/http"
+	ggrpc "google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	testpb "google.golang.org/grpc/interop/grpc_testing"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+)
+
+type testService struct {
+	testpb.UnimplementedTestServiceServer
+}
+
+func (testService) UnaryCall(ctx context.Context, req *testpb.SimpleRequest) (*testpb.SimpleResponse, error) {
+	reply := &testpb.SimpleResponse{Payload: req.Payload}
+	if sr, ok := authutil.RequestFromContext(ctx); ok {
+		reply.Username = sr.User
+	}
+	return reply, nil
+}
+
+// dialTestService starts an in-process grpc server with the server middlewares
+// and dials it with the client middlewares.
+func dialTestService(t *testing.T, server, client []middleware.Middleware) *ggrpc.ClientConn {
+	t.Helper()
+	srv := grpc.NewServer(grpc.Address("127.0.0.1:0"), grpc.Middleware(server...))
+	testpb.RegisterTestServiceServer(srv, testService{})
+	endpoint, err := srv.Endpoint()
+	if err != nil {
+		t.Fatal(err)
+	}
+	go srv.Start(context.Background())
+	t.Cleanup(func() { srv.Stop(context.Background()) })
+
+	conn, err := grpc.DialInsecure(context.Background(),
+		grpc.WithEndpoint(endpoint.Host),
+		grpc.WithMiddleware(client...),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return conn
+}
+
+// serveTestHTTP starts an http server with the POST /echo route of testService.UnaryCall,
+// the server filters and middlewares, and returns a client with the client options.
+func serveTestHTTP(t *testing.T, filters []http.FilterFunc, server []middleware.Middleware, client ...http.ClientOption) *http.Client {
+	t.Helper()
+	srv := http.NewServer(http.Address("127.0.0.1:0"), http.Filter(filters...),
+		http.Middleware(server...), http.ErrorEncoder(ErrorEncoder))
+	srv.Route("/").POST("/echo", func(ctx http.Context) error {
+		in := new(testpb.SimpleRequest)
+		if err := ctx.Bind(in); err != nil {
+			return err
+		}
+		h := ctx.Middleware(func(ctx context.Context, req interface{}) (interface{}, error) {
+			return testService{}.UnaryCall(ctx, req.(*testpb.SimpleRequest))
+		})
+		out, err := h(ctx, in)
+		if err != nil {
+			return err
+		}
+		return ctx.Result(200, out)
+	})
+	endpoint, err := srv.Endpoint()
+	if err != nil {
+		t.Fatal(err)
+	}
+	go srv.Start(context.Background())
+	t.Cleanup(func() { srv.Stop(context.Background()) })
+
+	conn, err := http.NewClient(context.Background(), append([]http.ClientOption{http.WithEndpoint(endpoint.Host)}, client...)...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return conn
+}
+
+// signedEcho posts req to /echo, signed with the user and key of the SignInfo if any.
+func signedEcho(t *testing.T, client *http.Client, user, key string, req *testpb.SimpleRequest) (*testpb.SimpleResponse, error) {
+	t.Helper()
+	body, err := encoding.GetCodec("json").Marshal(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.WithValue(context.Background(), SignKey{}, &SignInfo{User: user, Key: key, Body: body})
+	reply := new(testpb.SimpleResponse)
+	return reply, client.Invoke(ctx, "POST", "/echo", req, reply)
+}
+
+func TestAuthHttpClient(t *testing.T) {
+	users := map[string]struct{}{"user": {}, "partner": {}}
+	client := serveTestHTTP(t,
+		[]http.FilterFunc{AuthBodyFilter()},
+		[]middleware.Middleware{AuthHttp(users, "key", "")},
+		http.WithMiddleware(AuthHttpClient("user", "key")),
+	)
+	req := &testpb.SimpleRequest{Payload: &testpb.Payload{Body: []byte("payload")}}
+	tests := []struct {
+		name      string
+		user, key string
+		want      string
+	}{
+		{"client user", "", "", "user"},
+		// the Auth-User header names the user of the SignInfo it was signed for
+		{"sign info user", "partner", "key", "partner"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			reply, err := signedEcho(t, client, tt.user, tt.key, req)
+			if err != nil {
+				t.Fatalf("Invoke() = %v", err)
+			}
+			if reply.Username != tt.want {
+				t.Errorf("Invoke() user = %q, want %q", reply.Username, tt.want)
+			}
+		})
+	}
+}
+
+func TestAuthBodyFilterHash(t *testing.T) {
+	users := map[string]struct{}{"user": {}}
+	// the upload is over the buffered body size, it is spooled in the hash-of-body mode
+	server := authutil.WithMaxBodySize(16)
+	client := serveTestHTTP(t,
+		[]http.FilterFunc{AuthBodyFilter(server)},
+		[]middleware.Middleware{AuthHttp(users, "key", "", server)},
+		http.WithMiddleware(AuthHttpClient("user", "key", authutil.WithBodyHash())),
+	)
+	req := &testpb.SimpleRequest{Payload: &testpb.Payload{Body: []byte("a multipart upload")}}
+	reply, err := signedEcho(t, client, "", "", req)
+	if err != nil {
+		t.Fatalf("Invoke() = %v", err)
+	}
+	if string(reply.Payload.Body) != "a multipart upload" {
+		t.Errorf("Invoke() = %v", reply)
+	}
+}
+
+func TestAuthGrpcSignedPayload(t *testing.T) {
+	users := map[string]struct{}{"user": {}}
+	opts := []authutil.Option{authutil.WithAlg(authutil.AlgHMACSHA256), authutil.WithNonce(), authutil.WithSignedPayload()}
+	client := testpb.NewTestServiceClient(dialTestService(t,
+		[]middleware.Middleware{AuthGrpc(users, "key", "", authutil.WithSignedPayload(), authutil.WithNonceRequired())},
+		[]middleware.Middleware{AuthGrpcClient("user", "key", opts...), tamper},
+	))
+
+	req := &testpb.SimpleRequest{ResponseSize: 1, Payload: &testpb.Payload{Body: []byte("payload")}}
+	for i := 0; i < 2; i++ {
+		reply, err := client.UnaryCall(context.Background(), req)
+		if err != nil {
+			t.Fatalf("UnaryCall() = %v", err)
+		}
+		if reply.Username != "user" || string(reply.Payload.Body) != "payload" {
+			t.Errorf("UnaryCall() = %v", reply)
+		}
+	}
+
+	req.Payload.Body = []byte("tamper")
+	if _, err := client.UnaryCall(context.Background(), req); status.Code(err) != codes.Unauthenticated {
+		t.Errorf("UnaryCall() tampered = %v, want Unauthenticated", err)
+	}
+	req.Payload.Body = []byte("reroute")
+	if _, err := client.UnaryCall(context.Background(), req); status.Code(err) != codes.Unauthenticated {
+		t.Errorf("UnaryCall() signed for another method = %v, want Unauthenticated", err)
+	}
+}
+
+// tamper changes the payload, or the signed Method to another operation,
+// after the request is signed, as a man-in-the-middle.
+func tamper(handler middleware.Handler) middleware.Handler {
+	return func(ctx context.Context, req interface{}) (interface{}, error) {
+		r, ok := req.(*testpb.SimpleRequest)
+		if !ok {
+			return handler(ctx, req)
+		}
+		switch string(r.Payload.Body) {
+		case "tamper":
+			r = proto.Clone(r).(*testpb.SimpleRequest)
+			r.Payload.Body = []byte("tampered")
+			req = r
+		case "reroute":
+			if tr, ok := transport.FromClientContext(ctx); ok {
+				tr.RequestHeader().Set(authutil.HeaderMethod, "EmptyCall")
+			}
+		}
+		return handler(ctx, req)
+	}
+}
+
+func TestAuthGrpcErrors(t *testing.T) {
+	users := map[string]struct{}{"user": {}}
+	req := &testpb.SimpleRequest{Payload: &testpb.Payload{Body: []byte("payload")}}
+	tests := []struct {
+		name   string
+		client middleware.Middleware
+		code   codes.Code
+		want   *errorutil.Error
+		// legacy is whether WithLegacyReply returns it as the reply
+		legacy bool
+	}{
+		{"bad key", AuthGrpcClient("user", "bad"), codes.Unauthenticated, errorutil.ErrSignatureError, true},
+		{"unknown user", AuthGrpcClient("other", "key"), codes.PermissionDenied, errorutil.ErrIllegaUser, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			conn := dialTestService(t,
+				[]middleware.Middleware{AuthGrpc(users, "key", "")},
+				[]middleware.Middleware{tt.client},
+			)
+			_, err := testpb.NewTestServiceClient(conn).UnaryCall(context.Background(), req)
+			if status.Code(err) != tt.code || !tt.want.Is(errorutil.FromError(err)) {
+				t.Errorf("UnaryCall() = %v, want %v %v", err, tt.code, tt.want)
+			}
+
+			legacy := dialTestService(t,
+				[]middleware.Middleware{AuthGrpc(users, "key", "", authutil.WithLegacyReply())},
+				[]middleware.Middleware{tt.client},
+			)
+			reply := new(errorutil.Status)
+			err = legacy.Invoke(context.Background(), "/grpc.testing.TestService/UnaryCall", req, reply)
+			if !tt.legacy {
+				if status.Code(err) != tt.code {
+					t.Errorf("Invoke() legacy = %v, want %v", err, tt.code)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Invoke() legacy = %v", err)
+			}
+			if reply.StatusCode != tt.want.StatusCode || reply.StatusReason != tt.want.StatusReason {
+				t.Errorf("Invoke() legacy reply = %v, want %v", reply, tt.want)
+			}
+		})
+	}
+}
+
+// authTransport is a grpc server transport of the UnaryCall operation.
+type authTransport struct {
+	serverTransport
+	reply headerCarrier
+}
+
+func (t authTransport) Operation() string             { return "/grpc.testing.TestService/UnaryCall" }
+func (t authTransport) ReplyHeader() transport.Header { return t.reply }
+
+type invalidRequest struct{}
+
+func (invalidRequest) Validate() error { return errors.New("invalid") }
+
+// TestAuthGrpcLegacyReply pins the shape of each rejection WithLegacyReply,
+// which the old clients rely on.
+func TestAuthGrpcLegacyReply(t *testing.T) {
+	users := map[string]struct{}{"user": {}}
+	legacy := AuthGrpc(users, "key", "", authutil.WithLegacyReply())(func(ctx context.Context, req interface{}) (interface{}, error) {
+		return "handled", nil
+	})
+	// signed returns a server context of the request signed by the user with the key at timestamp
+	signed := func(user, key string, timestamp time.Time) context.Context {
+		sr := &authutil.Request{User: user, Method: "UnaryCall", Timestamp: strconv.FormatInt(timestamp.UnixMilli(), 10)}
+		if err := authutil.NewOptions().Sign(context.Background(), sr, key); err != nil {
+			t.Fatal(err)
+		}
+		header := headerCarrier{}
+		sr.SetHeader(header.Set)
+		return transport.NewServerContext(context.Background(), authTransport{serverTransport{header: header}, headerCarrier{}})
+	}
+	tests := []struct {
+		name string
+		ctx  context.Context
+		req  interface{}
+		// reply is the rejection returned as the reply, err the one returned as the error
+		reply *errorutil.Error
+		err   *errorutil.Error
+	}{
+		{"no transport", context.Background(), nil, errorutil.ErrInternalError, nil},
+		{"unknown user", signed("other", "key", time.Now()), nil, nil, errorutil.ErrIllegaUser},
+		{"bad signature", signed("user", "bad", time.Now()), nil, errorutil.ErrSignatureError, nil},
+		{"expired", signed("user", "key", time.Now().Add(-time.Hour)), nil, errorutil.ErrExpiredSignature, nil},
+		{"invalid request", signed("user", "key", time.Now()), invalidRequest{}, errorutil.ErrIllegalRequest, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			reply, err := legacy(tt.ctx, tt.req)
+			if tt.err != nil {
+				if reply != nil || !tt.err.Is(err) {
+					t.Errorf("AuthGrpc() = %v, %v, want the error %v", reply, err, tt.err)
+				}
+				return
+			}
+			se, ok := reply.(*errorutil.Error)
+			if err != nil || !ok || !tt.reply.Is(se) {
+				t.Errorf("AuthGrpc() = %v, %v, want the reply %v", reply, err, tt.reply)
+			}
+		})
+	}
+	if reply, err := legacy(signed("user", "key", time.Now()), nil); reply != "handled" || err != nil {
+		t.Errorf("AuthGrpc() signed = %v, %v", reply, err)
+	}
+}
+
+func TestAnyOf(t *testing.T) {
+	users := map[string]struct{}{"user": {}}
+	secret := []byte("secret")
+	server := []middleware.Middleware{AnyOf(
+		JWT(authutil.NewJWTVerifier(authutil.StaticKey(secret))),
+		AuthGrpc(users, "key", ""),
+	)}
+	// bearer signs an HS256 token of alice
+	bearer := func(handler middleware.Handler) middleware.Handler {
+		return func(ctx context.Context, req interface{}) (interface{}, error) {
+			header := base64.RawURLEncoding.EncodeToString([]byte(`{"alg":"HS256"}`))
+			payload := base64.RawURLEncoding.EncodeToString([]byte(`{"sub":"alice","exp":4102444800}`))
+			mac := hmac.New(sha256.New, secret)
+			mac.Write([]byte(header + "." + payload))
+			token := header + "." + payload + "." + base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+			if tr, ok := transport.FromClientContext(ctx); ok {
+				tr.RequestHeader().Set(authutil.HeaderAuthorization, "Bearer "+token)
+			}
+			return handler(ctx, req)
+		}
+	}
+	req := &testpb.SimpleRequest{Payload: &testpb.Payload{Body: []byte("payload")}}
+	tests := []struct {
+		name   string
+		client middleware.Middleware
+		code   codes.Code
+	}{
+		{"bearer", bearer, codes.OK},
+		{"signature", AuthGrpcClient("user", "key"), codes.OK},
+		{"none", func(handler middleware.Handler) middleware.Handler { return handler }, codes.Unauthenticated},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			conn := dialTestService(t, server, []middleware.Middleware{tt.client})
+			_, err := testpb.NewTestServiceClient(conn).UnaryCall(context.Background(), req)
+			if status.Code(err) != tt.code {
+				t.Errorf("UnaryCall() = %v, want %v", err, tt.code)
+			}
+		})
+	}
+
+	defer func() {
+		if recover() == nil {
+			t.Error("AnyOf() without middlewares must panic")
+		}
+	}()
+	AnyOf()
+}
@@ -0,0 +1,30 @@
+package kmid
+
+import (
+	"context"
+
+	authutil "github.com/XuThreeFire/goutil/authx"
+	ecode "github.com/XuThreeFire/goutil/errorx"
+
+	"github.com/go-kratos/kratos/v2/middleware"
+	"github.com/go-kratos/kratos/v2/transport"
+)
+
+// Authorize is the server middleware enforcing the policy of the authorizer on the operation,
+// after the authentication by AuthHttp, AuthGrpc or JWT. A denied request is rejected
+// with errorx.ErrIllegalRequest, unless the authorizer is in the dry-run mode.
+func Authorize(a *authutil.Authorizer) middleware.Middleware {
+	return func(handler middleware.Handler) middleware.Handler {
+		return func(ctx context.Context, req interface{}) (reply interface{}, err error) {
+			tr, ok := transport.FromServerContext(ctx)
+			if !ok {
+				return nil, ecode.ErrInternalError
+			}
+			user, roles := authutil.SubjectFromContext(ctx)
+			if err := a.Authorize(ctx, user, roles, tr.Operation()); err != nil {
+				return nil, err
+			}
+			return handler(ctx, req)
+		}
+	}
+}
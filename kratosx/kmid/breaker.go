@@ -2,62 +2,299 @@ package kmid
 
 import (
 	"context"
+	"net"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	errorutil "github.com/XuThreeFire/goutil/errorx"
 
 	"github.com/go-kratos/aegis/circuitbreaker"
 	"github.com/go-kratos/aegis/circuitbreaker/sre"
 	"github.com/go-kratos/kratos/v2/errors"
 	"github.com/go-kratos/kratos/v2/middleware"
+	"github.com/go-kratos/kratos/v2/selector"
 	"github.com/go-kratos/kratos/v2/transport"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
 )
 
 // ErrNotAllowed is request failed due to circuit breaker triggered.
 var ErrNotAllowed = errors.New(503, "CIRCUITBREAKER", "request failed due to circuit breaker triggered")
 
+// defaultWindow is the stat window of sre.NewBreaker.
+const defaultWindow = 3 * time.Second
+
+// breakerIdle is how long an unused breaker is kept, e.g. of an instance removed from discovery.
+const breakerIdle = 10 * time.Minute
+
+// State is circuit breaker state.
+type State int32
+
+const (
+	// StateClosed requests are allowed.
+	StateClosed State = iota
+	// StateOpen requests are being rejected.
+	StateOpen
+)
+
+// String returns the name of the state.
+func (s State) String() string {
+	if s == StateOpen {
+		return "open"
+	}
+	return "closed"
+}
+
 // Option is circuit breaker option.
 type Option func(*options)
 
 // WithGroup with circuit breaker group.
 // NOTE: implements generics circuitbreaker.CircuitBreaker
+// The breakers of the group are configured by it, NewBreakers panics if WithSuccess,
+// WithRequest or WithWindow are passed too.
 func WithGroup(g *Group) Option {
 	return func(o *options) {
 		o.group = g
 	}
 }
 
+// WithFailure with the predicate of the errors counted as failures, by default the server
+// faults of the upstream and the transport failures, see IsFailure.
+func WithFailure(f func(err error) bool) Option {
+	return func(o *options) {
+		o.failure = f
+	}
+}
+
+// WithInstance keys the breakers by operation and target instance, so a failing
+// instance is broken without the others. The instance is the endpoint of a client
+// dialed directly, use NodeFilter for a client on discovery.
+func WithInstance() Option {
+	return func(o *options) {
+		o.instance = true
+	}
+}
+
+// WithSuccess with the success ratio under which the sre breaker rejects requests, 0.6 by default.
+func WithSuccess(s float64) Option {
+	return func(o *options) {
+		o.sre = append(o.sre, sre.WithSuccess(s))
+	}
+}
+
+// WithRequest with the minimum requests in the window before the sre breaker rejects, 100 by default.
+func WithRequest(r int64) Option {
+	return func(o *options) {
+		o.sre = append(o.sre, sre.WithRequest(r))
+	}
+}
+
+// WithWindow with the stat window of the sre breaker, 3s by default.
+// It is also how long a breaker must not reject before it is reported closed.
+func WithWindow(d time.Duration) Option {
+	return func(o *options) {
+		o.sre = append(o.sre, sre.WithWindow(d))
+		o.window = d
+	}
+}
+
+// WithStateChange with the callback of the breaker state changes, for alerting and logging.
+// The key is the operation, or "operation@instance" WithInstance.
+func WithStateChange(f func(key string, from, to State)) Option {
+	return func(o *options) {
+		o.onStateChange = f
+	}
+}
+
 type options struct {
-	group *Group
+	group         *Group
+	failure       func(err error) bool
+	instance      bool
+	sre           []sre.Option
+	window        time.Duration
+	onStateChange func(key string, from, to State)
 }
 
-// Breaker circuitbreaker middlewarex will return errBreakerTriggered when the circuit
-// breaker is triggered and the request is rejected directly.
-func Breaker(opts ...Option) middleware.Middleware {
+// Breakers are the circuit breakers of a client, keyed by operation or WithInstance
+// by operation and instance. The breakers unused for 10 minutes are dropped.
+type Breakers struct {
+	lastSweep int64 // first for the 64-bit alignment of atomic
+
+	opt    *options
+	states sync.Map // key -> *breakerState
+	now    func() time.Time
+}
+
+type breakerState struct {
+	lastReject int64
+	lastUsed   int64
+	state      int32
+}
+
+// NewBreakers news the circuit breakers of a client.
+func NewBreakers(opts ...Option) *Breakers {
 	opt := &options{
-		group: NewGroup(func() interface{} {
-			return sre.NewBreaker()
-		}),
+		failure: IsFailure,
+		window:  defaultWindow,
 	}
 	for _, o := range opts {
 		o(opt)
 	}
+	if opt.group != nil && len(opt.sre) > 0 {
+		panic("kmid: WithSuccess, WithRequest and WithWindow do not apply to the breakers WithGroup")
+	}
+	if opt.group == nil {
+		sreOpts := opt.sre
+		opt.group = NewGroup(func() interface{} {
+			return sre.NewBreaker(sreOpts...)
+		})
+	}
+	return &Breakers{opt: opt, now: time.Now}
+}
+
+// Breaker circuitbreaker middlewarex will return errBreakerTriggered when the circuit
+// breaker is triggered and the request is rejected directly.
+// The server faults of the upstream are counted as failures, see IsFailure and WithFailure.
+func Breaker(opts ...Option) middleware.Middleware {
+	return NewBreakers(opts...).Middleware()
+}
+
+// IsFailure is the default failure predicate of the breakers. An error of the upstream, an
+// errorx error or one with a grpc status such as a kratos errors.Error, is a failure if errorx
+// classifies it as a server fault, except a rate limit, ErrTooManyRequests or ResourceExhausted,
+// which is the upstream protecting itself. Of the other errors only the transport failures,
+// a net.Error or a deadline exceeded, are failures, not the plain errors of the handlers.
+func IsFailure(err error) bool {
+	var se interface{ GRPCStatus() *status.Status }
+	if !errors.As(err, &se) {
+		var ne net.Error
+		return errors.Is(err, context.DeadlineExceeded) || errors.As(err, &ne)
+	}
+	if errorutil.ErrTooManyRequests.Is(err) || se.GRPCStatus().Code() == codes.ResourceExhausted {
+		return false
+	}
+	return errorutil.IsServerFault(err)
+}
+
+// Middleware is the client middleware of the breakers.
+func (b *Breakers) Middleware() middleware.Middleware {
 	return func(handler middleware.Handler) middleware.Handler {
 		return func(ctx context.Context, req interface{}) (interface{}, error) {
 			info, _ := transport.FromClientContext(ctx)
-			breaker := opt.group.Get(info.Operation()).(circuitbreaker.CircuitBreaker)
-			if err := breaker.Allow(); err != nil {
-				// rejected
-				// NOTE: when client reject requets locally,
-				// continue add counter let the drop ratio higher.
-				breaker.MarkFailed()
-				return nil, ErrNotAllowed
+			key := info.Operation()
+			if b.opt.instance {
+				key = ""
+				// the instance of a discovery client is only known once selected
+				if endpoint := info.Endpoint(); !strings.HasPrefix(endpoint, "discovery:") {
+					key = instanceKey(info.Operation(), endpoint)
+				}
+			}
+			if key != "" {
+				breaker := b.breaker(key)
+				if !b.allow(key, breaker) {
+					// rejected
+					// NOTE: when client reject requets locally,
+					// continue add counter let the drop ratio higher.
+					breaker.MarkFailed()
+					return nil, ErrNotAllowed
+				}
 			}
 			// allowed
 			reply, err := handler(ctx, req)
-			if err != nil && (errors.IsInternalServer(err) || errors.IsServiceUnavailable(err) || errors.IsGatewayTimeout(err)) {
-				breaker.MarkFailed()
+			if key == "" {
+				p, ok := selector.FromPeerContext(ctx)
+				if !ok || p.Node == nil {
+					// no instance was selected, e.g. all of them are broken
+					return reply, err
+				}
+				key = instanceKey(info.Operation(), p.Node.Address())
+			}
+			if err != nil && b.opt.failure(err) {
+				b.breaker(key).MarkFailed()
 			} else {
-				breaker.MarkSuccess()
+				b.breaker(key).MarkSuccess()
 			}
 			return reply, err
 		}
 	}
 }
+
+// NodeFilter is the node filter of a discovery client WithInstance, it filters out the
+// instances whose breaker of the operation rejects the request, counted as failures like
+// the rejections of the middleware. Pass it to the grpc.WithNodeFilter or http.WithNodeFilter
+// client option along with the middleware.
+func (b *Breakers) NodeFilter() selector.NodeFilter {
+	return func(ctx context.Context, nodes []selector.Node) []selector.Node {
+		info, ok := transport.FromClientContext(ctx)
+		if !ok {
+			return nodes
+		}
+		allowed := make([]selector.Node, 0, len(nodes))
+		for _, n := range nodes {
+			key := instanceKey(info.Operation(), n.Address())
+			breaker := b.breaker(key)
+			if !b.allow(key, breaker) {
+				breaker.MarkFailed()
+				continue
+			}
+			allowed = append(allowed, n)
+		}
+		return allowed
+	}
+}
+
+// State returns the state of the breaker of the key.
+func (b *Breakers) State(key string) State {
+	if v, ok := b.states.Load(key); ok {
+		return State(atomic.LoadInt32(&v.(*breakerState).state))
+	}
+	return StateClosed
+}
+
+func (b *Breakers) breaker(key string) circuitbreaker.CircuitBreaker {
+	return b.opt.group.Get(key).(circuitbreaker.CircuitBreaker)
+}
+
+// allow reports whether the breaker allows the request and tracks its state: it opens
+// when it rejects a request, and closes once it did not reject any for the window.
+func (b *Breakers) allow(key string, breaker circuitbreaker.CircuitBreaker) bool {
+	now := b.now().UnixNano()
+	b.sweep(now)
+	v, _ := b.states.LoadOrStore(key, new(breakerState))
+	s := v.(*breakerState)
+	atomic.StoreInt64(&s.lastUsed, now)
+	if err := breaker.Allow(); err != nil {
+		atomic.StoreInt64(&s.lastReject, now)
+		if atomic.CompareAndSwapInt32(&s.state, int32(StateClosed), int32(StateOpen)) && b.opt.onStateChange != nil {
+			b.opt.onStateChange(key, StateClosed, StateOpen)
+		}
+		return false
+	}
+	if atomic.LoadInt32(&s.state) == int32(StateOpen) &&
+		time.Duration(now-atomic.LoadInt64(&s.lastReject)) > b.opt.window &&
+		atomic.CompareAndSwapInt32(&s.state, int32(StateOpen), int32(StateClosed)) && b.opt.onStateChange != nil {
+		b.opt.onStateChange(key, StateOpen, StateClosed)
+	}
+	return true
+}
+
+// sweep drops the breakers unused for breakerIdle, at most once per breakerIdle.
+func (b *Breakers) sweep(now int64) {
+	last := atomic.LoadInt64(&b.lastSweep)
+	if time.Duration(now-last) < breakerIdle || !atomic.CompareAndSwapInt64(&b.lastSweep, last, now) {
+		return
+	}
+	b.states.Range(func(k, v interface{}) bool {
+		if time.Duration(now-atomic.LoadInt64(&v.(*breakerState).lastUsed)) > breakerIdle {
+			b.states.Delete(k)
+			b.opt.group.Delete(k.(string))
+		}
+		return true
+	})
+}
+
+func instanceKey(operation, instance string) string {
+	return operation + "@" + instance
+}
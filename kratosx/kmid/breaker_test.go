@@ -0,0 +1,185 @@
+package kmid
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	errorutil "github.com/XuThreeFire/goutil/errorx"
+
+	kerrors "github.com/go-kratos/kratos/v2/errors"
+	"github.com/go-kratos/kratos/v2/selector"
+	"github.com/go-kratos/kratos/v2/transport"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+type clientTransport struct {
+	transport.Transporter
+	endpoint  string
+	operation string
+}
+
+func (t clientTransport) Endpoint() string  { return t.endpoint }
+func (t clientTransport) Operation() string { return t.operation }
+
+func clientContext(endpoint, operation string) context.Context {
+	return transport.NewClientContext(context.Background(), clientTransport{endpoint: endpoint, operation: operation})
+}
+
+func TestBreaker(t *testing.T) {
+	var (
+		mu      sync.Mutex
+		changes []string
+	)
+	b := NewBreakers(WithInstance(), WithRequest(10), WithStateChange(func(key string, from, to State) {
+		mu.Lock()
+		changes = append(changes, key+" "+from.String()+"->"+to.String())
+		mu.Unlock()
+	}))
+	m := b.Middleware()
+	failing := m(func(ctx context.Context, req interface{}) (interface{}, error) {
+		return nil, errorutil.ErrInternalError
+	})
+	invalid := m(func(ctx context.Context, req interface{}) (interface{}, error) {
+		return nil, errorutil.ErrIllegalRequest
+	})
+
+	bad, good := clientContext("10.0.0.1:9000", "/api.Order/Query"), clientContext("10.0.0.2:9000", "/api.Order/Query")
+	var rejected int
+	for i := 0; i < 200; i++ {
+		if _, err := failing(bad, nil); err == ErrNotAllowed {
+			rejected++
+		}
+		if _, err := invalid(good, nil); err == ErrNotAllowed {
+			t.Fatal("client faults opened the breaker")
+		}
+	}
+	if rejected == 0 {
+		t.Fatal("server faults did not open the breaker")
+	}
+	if got := b.State("/api.Order/Query@10.0.0.1:9000"); got != StateOpen {
+		t.Errorf("State() = %s, want open", got)
+	}
+	mu.Lock()
+	if len(changes) != 1 || changes[0] != "/api.Order/Query@10.0.0.1:9000 closed->open" {
+		t.Errorf("state changes = %v", changes)
+	}
+	mu.Unlock()
+
+	// the instances of a discovery client are broken by the node filter
+	nodes := []selector.Node{
+		selector.NewNode("grpc", "10.0.0.1:9000", nil),
+		selector.NewNode("grpc", "10.0.0.2:9000", nil),
+	}
+	var filtered int
+	for i := 0; i < 50; i++ {
+		got := b.NodeFilter()(clientContext("discovery:///order", "/api.Order/Query"), nodes)
+		for _, n := range got {
+			if n.Address() == "10.0.0.1:9000" {
+				filtered--
+			}
+		}
+		filtered++
+	}
+	if filtered == 0 {
+		t.Error("NodeFilter() never filtered out the broken instance")
+	}
+
+	// a custom failure predicate counts the client faults too
+	b = NewBreakers(WithRequest(10), WithFailure(func(err error) bool { return err != nil }))
+	invalid = b.Middleware()(func(ctx context.Context, req interface{}) (interface{}, error) {
+		return nil, errorutil.ErrIllegalRequest
+	})
+	for i := 0; i < 200; i++ {
+		invalid(good, nil)
+	}
+	if b.State("/api.Order/Query") != StateOpen {
+		t.Error("WithFailure() client faults did not open the breaker")
+	}
+}
+
+func TestIsFailure(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want bool
+	}{
+		{"kratos internal", kerrors.InternalServer("INTERNAL", "db down"), true},
+		{"kratos unavailable", kerrors.ServiceUnavailable("UNAVAILABLE", "overloaded"), true},
+		{"kratos too many requests", kerrors.New(429, "RATE_LIMIT", "slow down"), false},
+		{"kratos bad request", kerrors.BadRequest("INVALID", "bad id"), false},
+		{"kratos wrapped", fmt.Errorf("query: %w", kerrors.GatewayTimeout("TIMEOUT", "slow")), true},
+		{"grpc resource exhausted", status.Error(codes.ResourceExhausted, "quota"), false},
+		{"grpc unavailable", status.Error(codes.Unavailable, "connection refused"), true},
+		{"errorx internal", errorutil.ErrInternalError, true},
+		{"errorx too many requests", errorutil.ErrTooManyRequests, false},
+		{"errorx over grpc", errorutil.ErrInternalError.GRPCStatus().Err(), true},
+		{"plain", fmt.Errorf("order %d not found", 1), false},
+		{"deadline", fmt.Errorf("call: %w", context.DeadlineExceeded), true},
+		{"net", &net.OpError{Op: "dial", Net: "tcp", Err: errors.New("connection refused")}, true},
+	}
+	for _, tt := range tests {
+		if got := IsFailure(tt.err); got != tt.want {
+			t.Errorf("%s: IsFailure(%v) = %v, want %v", tt.name, tt.err, got, tt.want)
+		}
+	}
+
+	// an upstream rate limiting or a handler returning plain errors does not open the breaker
+	b := NewBreakers(WithInstance(), WithRequest(10))
+	for _, err := range []error{kerrors.New(429, "RATE_LIMIT", "slow down"), errors.New("order not found")} {
+		h := b.Middleware()(func(ctx context.Context, req interface{}) (interface{}, error) {
+			return nil, err
+		})
+		for i := 0; i < 200; i++ {
+			if _, got := h(clientContext("10.0.0.1:9000", "/api.Order/Query"), nil); got == ErrNotAllowed {
+				t.Fatalf("%v opened the breaker", err)
+			}
+		}
+	}
+}
+
+// rejecting is a breaker rejecting every request, counting the failures marked.
+type rejecting struct{ failed int32 }
+
+func (b *rejecting) Allow() error { return errors.New("rejected") }
+func (b *rejecting) MarkSuccess() {}
+func (b *rejecting) MarkFailed()  { atomic.AddInt32(&b.failed, 1) }
+
+func TestBreakersGroup(t *testing.T) {
+	breaker := new(rejecting)
+	b := NewBreakers(WithInstance(), WithGroup(NewGroup(func() interface{} { return breaker })))
+	nodes := []selector.Node{selector.NewNode("grpc", "10.0.0.1:9000", nil)}
+	if got := b.NodeFilter()(clientContext("discovery:///order", "/api.Order/Query"), nodes); len(got) != 0 {
+		t.Fatalf("NodeFilter() = %v, want the instance filtered out", got)
+	}
+	if atomic.LoadInt32(&breaker.failed) != 1 {
+		t.Errorf("NodeFilter() rejection marked failed %d times, want 1", breaker.failed)
+	}
+
+	// the breakers of the instances gone from the discovery are dropped
+	now := time.Now()
+	b.now = func() time.Time { return now }
+	now = now.Add(breakerIdle + time.Second)
+	b.NodeFilter()(clientContext("discovery:///order", "/api.Order/Query"), []selector.Node{
+		selector.NewNode("grpc", "10.0.0.2:9000", nil),
+	})
+	if _, ok := b.states.Load("/api.Order/Query@10.0.0.1:9000"); ok {
+		t.Error("the breaker of the removed instance was kept")
+	}
+	if _, ok := b.states.Load("/api.Order/Query@10.0.0.2:9000"); !ok {
+		t.Error("the breaker of the current instance was dropped")
+	}
+
+	defer func() {
+		if recover() == nil {
+			t.Error("NewBreakers() WithGroup and WithRequest must panic")
+		}
+	}()
+	NewBreakers(WithGroup(NewGroup(func() interface{} { return breaker })), WithRequest(10))
+}
@@ -0,0 +1,87 @@
+package kmid
+
+import (
+	"context"
+	stdhttp "net/http"
+	"strconv"
+
+	errorutil "github.com/XuThreeFire/goutil/errorx"
+	limitutil "github.com/XuThreeFire/goutil/limitx"
+
+	"github.com/go-kratos/kratos/v2/errors"
+	"github.com/go-kratos/kratos/v2/transport/http"
+)
+
+// ErrorEncoder is an http server error encoder, errorx errors are encoded as the
+// statusCode/statusReason body with the http status mapped from the errorx code,
+// a BatchError also encodes its items array.
+// Other errors are encoded by http.DefaultErrorEncoder.
+// Use it with http.ErrorEncoder(kmid.ErrorEncoder).
+func ErrorEncoder(w stdhttp.ResponseWriter, r *stdhttp.Request, err error) {
+	var v interface{}
+	if be := new(errorutil.BatchError); errors.As(err, &be) {
+		v = be
+	} else if se := new(errorutil.Error); errors.As(err, &se) {
+		v = se
+	} else {
+		http.DefaultErrorEncoder(w, r, err)
+		return
+	}
+	codec, _ := http.CodecForRequest(r, "Accept")
+	body, marshalErr := codec.Marshal(v)
+	if marshalErr != nil {
+		w.WriteHeader(stdhttp.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/"+codec.Name())
+	w.WriteHeader(errorutil.HTTPStatus(err))
+	_, _ = w.Write(body)
+}
+
+// ErrorDecoder is an http client error decoder, the counterpart of ErrorEncoder: the
+// statusCode/statusReason body of a failed response is decoded as an errorx error, or else
+// its http status is mapped to an errorx code, so Retry and the breakers see the errorx code
+// of the upstream. A Retry-After reply header is kept as the retry_after metadata.
+// Use it with http.WithErrorDecoder(kmid.ErrorDecoder).
+func ErrorDecoder(_ context.Context, res *stdhttp.Response) error {
+	if res.StatusCode >= 200 && res.StatusCode <= 299 {
+		return nil
+	}
+	se := errorutil.FromHTTPResponse(res)
+	if se == nil {
+		return errors.New(res.StatusCode, errors.UnknownReason, "")
+	}
+	if after := res.Header.Get(limitutil.HeaderRetryAfter); after != "" && se.Metadata[limitutil.MetadataRetryAfter] == "" {
+		md := map[string]string{limitutil.MetadataRetryAfter: after}
+		for k, v := range se.Metadata {
+			md[k] = v
+		}
+		se = se.WithMetadata(md)
+	}
+	return se
+}
+
+// KratosError converts an errorx to a kratos error carrying the mapped http status,
+// the StatusCode as reason and the StatusReason as message.
+// Other errors are converted by errors.FromError.
+func KratosError(err error) *errors.Error {
+	se := new(errorutil.Error)
+	if !errors.As(err, &se) {
+		return errors.FromError(err)
+	}
+	return errors.New(errorutil.HTTPStatus(se), strconv.Itoa(int(se.StatusCode)), se.StatusReason).
+		WithMetadata(se.Metadata).
+		WithCause(err)
+}
+
+// FromKratosError converts a kratos error to an errorx,
+// the StatusCode is restored from the reason or else mapped from the http status.
+func FromKratosError(err *errors.Error) *errorutil.Error {
+	if err == nil {
+		return nil
+	}
+	if code, e := strconv.Atoi(err.Reason); e == nil {
+		return errorutil.New(code, err.Message, false).WithMetadata(err.Metadata)
+	}
+	return errorutil.FromGRPCStatus(err.GRPCStatus())
+}
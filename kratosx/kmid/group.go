@@ -45,6 +45,13 @@ func (g *Group) Get(key string) interface{} {
 	return v
 }
 
+// Delete deletes the object of the key, it is created again on the next Get.
+func (g *Group) Delete(key string) {
+	g.Lock()
+	delete(g.vals, key)
+	g.Unlock()
+}
+
 // Reset resets the new function and deletes all existing objects.
 func (g *Group) Reset(new func() interface{}) {
 	if new == nil {
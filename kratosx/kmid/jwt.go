@@ -0,0 +1,70 @@
+package kmid
+
+import (
+	"context"
+
+	authutil "github.com/XuThreeFire/goutil/authx"
+	ecode "github.com/XuThreeFire/goutil/errorx"
+
+	"github.com/go-kratos/kratos/v2/middleware"
+	"github.com/go-kratos/kratos/v2/transport"
+)
+
+// JWT is the server middleware authenticating the bearer token of the Authorization header,
+// the claims are mapped into the context by authutil.JWTVerifier.NewContext.
+// Combine it with AuthHttp or AuthGrpc by AnyOf to accept either scheme.
+func JWT(v *authutil.JWTVerifier) middleware.Middleware {
+	return func(handler middleware.Handler) middleware.Handler {
+		return func(ctx context.Context, req interface{}) (reply interface{}, err error) {
+			tr, ok := transport.FromServerContext(ctx)
+			if !ok {
+				return nil, ecode.ErrInternalError
+			}
+			token, ok := authutil.BearerToken(tr.RequestHeader().Get(authutil.HeaderAuthorization))
+			if !ok {
+				return nil, ecode.ErrSignatureError.WithMessage("missing bearer token")
+			}
+			claims, err := v.Verify(ctx, token)
+			if err != nil {
+				return nil, err
+			}
+			return handler(v.NewContext(ctx, claims), req)
+		}
+	}
+}
+
+// AnyOf is the "any of" policy of the authentication middlewares: a request is accepted
+// by the first middleware which accepts it, in order, and rejected with the rejection
+// of the first one if none does. The middlewares must only act before the handler.
+// It panics without middlewares, which would accept every request.
+func AnyOf(ms ...middleware.Middleware) middleware.Middleware {
+	if len(ms) == 0 {
+		panic("kmid: AnyOf requires at least one middleware")
+	}
+	return func(handler middleware.Handler) middleware.Handler {
+		return func(ctx context.Context, req interface{}) (interface{}, error) {
+			var (
+				firstReply interface{}
+				firstErr   error
+			)
+			for i, m := range ms {
+				var (
+					accepted bool
+					authCtx  context.Context
+					authReq  interface{}
+				)
+				reply, err := m(func(ctx context.Context, req interface{}) (interface{}, error) {
+					accepted, authCtx, authReq = true, ctx, req
+					return nil, nil
+				})(ctx, req)
+				if accepted {
+					return handler(authCtx, authReq)
+				}
+				if i == 0 {
+					firstReply, firstErr = reply, err
+				}
+			}
+			return firstReply, firstErr
+		}
+	}
+}
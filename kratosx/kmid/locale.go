@@ -0,0 +1,29 @@
+package kmid
+
+import (
+	"context"
+
+	errorutil "github.com/XuThreeFire/goutil/errorx"
+
+	"github.com/go-kratos/kratos/v2/middleware"
+	"github.com/go-kratos/kratos/v2/transport"
+)
+
+// Locale is a server middleware that captures the Accept-Language header into the context
+// and renders the reason of returned errorx errors in that language.
+func Locale() middleware.Middleware {
+	return func(handler middleware.Handler) middleware.Handler {
+		return func(ctx context.Context, req interface{}) (reply interface{}, err error) {
+			if tr, ok := transport.FromServerContext(ctx); ok {
+				if locales := errorutil.ParseAcceptLanguage(tr.RequestHeader().Get("Accept-Language")); len(locales) > 0 {
+					ctx = errorutil.NewLocaleContext(ctx, locales...)
+				}
+			}
+			reply, err = handler(ctx, req)
+			if err != nil {
+				err = errorutil.Localize(ctx, err)
+			}
+			return
+		}
+	}
+}
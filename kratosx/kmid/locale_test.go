@@ -0,0 +1,64 @@
+package kmid
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+
+	errorutil "github.com/XuThreeFire/goutil/errorx"
+
+	"github.com/go-kratos/kratos/v2/transport"
+	"google.golang.org/grpc/metadata"
+)
+
+type headerCarrier metadata.MD
+
+func (c headerCarrier) Get(key string) string {
+	if v := metadata.MD(c).Get(key); len(v) > 0 {
+		return v[0]
+	}
+	return ""
+}
+
+func (c headerCarrier) Set(key, value string) { metadata.MD(c).Set(key, value) }
+
+func (c headerCarrier) Keys() []string {
+	keys := make([]string, 0, len(c))
+	for k := range c {
+		keys = append(keys, k)
+	}
+	return keys
+}
+
+type serverTransport struct {
+	transport.Transporter
+	header headerCarrier
+}
+
+func (t serverTransport) RequestHeader() transport.Header { return t.header }
+
+func TestLocale(t *testing.T) {
+	ctx := transport.NewServerContext(context.Background(), serverTransport{
+		header: headerCarrier(metadata.Pairs("Accept-Language", "en-US,en;q=0.9")),
+	})
+	batch := errorutil.NewBatchError(nil)
+	batch.Add(2, errorutil.ErrNotFound)
+	_, err := Locale()(func(ctx context.Context, req interface{}) (interface{}, error) {
+		return nil, fmt.Errorf("import orders: %w", batch)
+	})(ctx, nil)
+
+	be := new(errorutil.BatchError)
+	if !errors.As(err, &be) {
+		t.Fatalf("Locale() = %T %v, want the BatchError kept", err, err)
+	}
+	if got := errorutil.Reason(be); got != "incorrect or incomplete information" {
+		t.Errorf("batch reason = %s", got)
+	}
+	if items := be.Items(); len(items) != 1 || items[0].Err.StatusReason != "record not found" {
+		t.Errorf("batch items = %+v", items)
+	}
+	if got, want := err.Error(), "import orders: "+be.Error(); got != want {
+		t.Errorf("Error() = %s, want %s", got, want)
+	}
+}
@@ -38,7 +38,7 @@ func Server(logger log.Logger) middleware.Middleware {
 			reply, err = handler(ctx, req)
 			var level log.Level
 			if err != nil {
-				level, code, reason = extractError(err)
+				level, code, reason = extractError(ctx, err)
 			} else {
 				// parse reply errorx
 				level, code, reason = parseBizErr(reply)
@@ -69,19 +69,30 @@ func ExtractArgs(req interface{}) string {
 }
 
 // extractError returns the stringx of the errorx
-func extractError(err error) (log.Level, int32, string) {
-	if se := errors.FromError(err); se != nil {
-		return log.LevelError, se.Code, se.Reason + ":" + se.Message
+func extractError(ctx context.Context, err error) (log.Level, int32, string) {
+	if be := new(errorutil.BatchError); errors.As(err, &be) {
+		return errorLevel(err), int32(errorutil.Code(be)), errorutil.LocalizedReason(ctx, be) + ":" + be.Summary()
+	}
+	if se := new(errorutil.Error); errors.As(err, &se) {
+		return errorLevel(err), se.StatusCode, errorutil.LocalizedReason(ctx, se)
 	}
-	if se := errorutil.FromError(err); se != nil {
-		return log.LevelError, se.StatusCode, se.StatusReason
+	if se := errors.FromError(err); se != nil {
+		return errorLevel(err), se.Code, se.Reason + ":" + se.Message
 	}
 	if err != nil {
-		return log.LevelError, 0, fmt.Sprintf("%+v", err)
+		return errorLevel(err), 0, fmt.Sprintf("%+v", err)
 	}
 	return log.LevelInfo, 100, ""
 }
 
+// errorLevel returns the log level of err, client faults are logged as warnings.
+func errorLevel(err error) log.Level {
+	if errorutil.IsClientFault(err) {
+		return log.LevelWarn
+	}
+	return log.LevelError
+}
+
 // parseBizErr returns the biz result of the reply
 func parseBizErr(reply interface{}) (log.Level, int32, string) {
 	str, err := json.Marshal(reply)
@@ -105,7 +116,7 @@ func parseBizErr(reply interface{}) (log.Level, int32, string) {
 		code == errorutil.ReceiveSuccessCode {
 		return log.LevelInfo, int32(code), reason
 	}
-	return log.LevelError, int32(code), reason
+	return errorLevel(errorutil.New(int(code), reason, false)), int32(code), reason
 }
 
 // Client is an client logging middlewarex.
@@ -127,7 +138,7 @@ func Client(logger log.Logger) middleware.Middleware {
 			var level log.Level
 			var remoteAddr string
 			if err != nil {
-				level, code, reason = extractError(err)
+				level, code, reason = extractError(ctx, err)
 			} else {
 				// parse reply errorx
 				level, code, reason = parseBizErr(reply)
@@ -0,0 +1,47 @@
+package kmid
+
+import (
+	"context"
+	"errors"
+
+	authutil "github.com/XuThreeFire/goutil/authx"
+	ecode "github.com/XuThreeFire/goutil/errorx"
+	limitutil "github.com/XuThreeFire/goutil/limitx"
+
+	"github.com/go-kratos/kratos/v2/middleware"
+	"github.com/go-kratos/kratos/v2/transport"
+	"github.com/go-kratos/kratos/v2/transport/http"
+)
+
+// RateLimit is the server middleware limiting the rate of the requests of the callers,
+// keyed by the Auth-User (or bearer token user), operation or client IP of the limiter.
+// Put it after the authentication middleware so the user is known. A limited request is
+// rejected with errorx.ErrTooManyRequests and the Retry-After reply header.
+func RateLimit(l *limitutil.RateLimiter) middleware.Middleware {
+	return func(handler middleware.Handler) middleware.Handler {
+		return func(ctx context.Context, req interface{}) (reply interface{}, err error) {
+			tr, ok := transport.FromServerContext(ctx)
+			if !ok {
+				return nil, ecode.ErrInternalError
+			}
+			if err := l.Allow(ctx, callerFromContext(ctx, tr)); err != nil {
+				if se := new(ecode.Error); errors.As(err, &se) {
+					tr.ReplyHeader().Set(limitutil.HeaderRetryAfter, se.Metadata[limitutil.MetadataRetryAfter])
+				}
+				return nil, err
+			}
+			return handler(ctx, req)
+		}
+	}
+}
+
+func callerFromContext(ctx context.Context, tr transport.Transporter) limitutil.Caller {
+	user, _ := authutil.SubjectFromContext(ctx)
+	c := limitutil.Caller{User: user, Operation: tr.Operation()}
+	if ht, ok := tr.(http.Transporter); ok {
+		c.Addr = ht.Request().RemoteAddr
+	} else {
+		c.Addr = peerAddr(ctx)
+	}
+	return c
+}
@@ -0,0 +1,287 @@
+package kmid
+
+import (
+	"context"
+	"errors"
+	"math/rand"
+	nethttp "net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	authutil "github.com/XuThreeFire/goutil/authx"
+	ecode "github.com/XuThreeFire/goutil/errorx"
+	limitutil "github.com/XuThreeFire/goutil/limitx"
+
+	kerrors "github.com/go-kratos/kratos/v2/errors"
+	"github.com/go-kratos/kratos/v2/middleware"
+	"github.com/go-kratos/kratos/v2/transport"
+	"github.com/go-kratos/kratos/v2/transport/http"
+	"github.com/google/uuid"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/status"
+)
+
+const (
+	// DefaultMaxAttempts is the attempts of a request, the first one included.
+	DefaultMaxAttempts = 3
+	// DefaultBackoffBase is the backoff before the first retry, doubled on each retry.
+	DefaultBackoffBase = 100 * time.Millisecond
+	// DefaultBackoffMax is the longest backoff.
+	DefaultBackoffMax = 2 * time.Second
+)
+
+// RetryOption is retry option.
+type RetryOption func(*retryOptions)
+
+// WithMaxAttempts with the attempts of a request, the first one included, DefaultMaxAttempts by default.
+func WithMaxAttempts(n int) RetryOption {
+	return func(o *retryOptions) {
+		o.maxAttempts = n
+	}
+}
+
+// WithBackoff with the exponential backoff, a random wait up to base*2^retry capped at max,
+// DefaultBackoffBase and DefaultBackoffMax by default.
+func WithBackoff(base, max time.Duration) RetryOption {
+	return func(o *retryOptions) {
+		o.base, o.max = base, max
+	}
+}
+
+// WithRetryBudget with the retry budget of the client, shared by all its operations.
+// NewRetryBudget(0.2, 10) by default.
+func WithRetryBudget(b *RetryBudget) RetryOption {
+	return func(o *retryOptions) {
+		o.budget = b
+	}
+}
+
+// WithIdempotent with the idempotent operations, e.g. "/api.order.v1.Order/Get", which are
+// retried like the safe HTTP methods.
+func WithIdempotent(operations ...string) RetryOption {
+	return func(o *retryOptions) {
+		for _, op := range operations {
+			o.idempotent[op] = struct{}{}
+		}
+	}
+}
+
+// WithRetryable with the predicate of the retried errors, replacing the default:
+// the idempotent requests are retried on the retryable errors, see errorx.IsRetryable,
+// the others only on the errorx codes declared retryable, which the upstream rejected
+// without processing, e.g. errorx.ErrOverloaded.
+// The errorx codes of an http upstream are only known with the ErrorDecoder of the client.
+func WithRetryable(f func(ctx context.Context, idempotent bool, err error) bool) RetryOption {
+	return func(o *retryOptions) {
+		o.retryable = f
+	}
+}
+
+type retryOptions struct {
+	maxAttempts int
+	base, max   time.Duration
+	budget      *RetryBudget
+	idempotent  map[string]struct{}
+	retryable   func(ctx context.Context, idempotent bool, err error) bool
+}
+
+// Retry is the client middleware retrying the failed requests with exponential backoff and
+// jitter, within the retry budget of the client. A Retry-After of the upstream longer than
+// the max backoff is not waited for. Each attempt is signed again by AuthHttpClient or
+// AuthGrpcClient, wherever they are in the chain, with the same trace id. Give an http
+// client the ErrorDecoder so the errorx codes and Retry-After of the upstream are known.
+func Retry(opts ...RetryOption) middleware.Middleware {
+	o := &retryOptions{
+		maxAttempts: DefaultMaxAttempts,
+		base:        DefaultBackoffBase,
+		max:         DefaultBackoffMax,
+		idempotent:  make(map[string]struct{}),
+		retryable:   defaultRetryable,
+	}
+	for _, opt := range opts {
+		opt(o)
+	}
+	if o.budget == nil {
+		o.budget = NewRetryBudget(0.2, 10)
+	}
+	return func(handler middleware.Handler) middleware.Handler {
+		return func(ctx context.Context, req interface{}) (reply interface{}, err error) {
+			tr, ok := transport.FromClientContext(ctx)
+			if !ok {
+				return handler(ctx, req)
+			}
+			if _, ok := authutil.TraceIDFromContext(ctx); !ok {
+				ctx = authutil.NewTraceContext(ctx, uuid.NewString())
+			}
+			idempotent := o.isIdempotent(tr)
+			// the signing middlewares before Retry in the chain are not run again
+			resign, _ := ctx.Value(resignKey{}).(func() error)
+			o.budget.request()
+			for i := 0; ; i++ {
+				if i > 0 {
+					if err := rewindBody(tr); err != nil {
+						return nil, err
+					}
+					if resign != nil {
+						if err := resign(); err != nil {
+							return nil, err
+						}
+					}
+				}
+				reply, err = handler(ctx, req)
+				if err == nil || i+1 >= o.maxAttempts || ctx.Err() != nil || !o.retryable(ctx, idempotent, err) {
+					return reply, err
+				}
+				wait, ok := o.backoff(i, err)
+				if !ok || !o.budget.retry() {
+					return reply, err
+				}
+				timer := time.NewTimer(wait)
+				select {
+				case <-ctx.Done():
+					timer.Stop()
+					return reply, err
+				case <-timer.C:
+				}
+			}
+		}
+	}
+}
+
+func (o *retryOptions) isIdempotent(tr transport.Transporter) bool {
+	if _, ok := o.idempotent[tr.Operation()]; ok {
+		return true
+	}
+	if ht, ok := tr.(http.Transporter); ok && ht.Request() != nil {
+		switch ht.Request().Method {
+		case nethttp.MethodGet, nethttp.MethodHead, nethttp.MethodOptions, nethttp.MethodPut, nethttp.MethodDelete:
+			return true
+		}
+	}
+	return false
+}
+
+// backoff returns the wait before the retry, false if the upstream asked to wait longer than the max.
+func (o *retryOptions) backoff(retry int, err error) (time.Duration, bool) {
+	ceil := o.max
+	if retry < 30 && o.base<<retry < o.max {
+		ceil = o.base << retry
+	}
+	wait := time.Duration(rand.Int63n(int64(ceil) + 1))
+	if s, ok := errorMetadata(err)[limitutil.MetadataRetryAfter]; ok {
+		seconds, _ := strconv.Atoi(s)
+		after := time.Duration(seconds) * time.Second
+		if after > o.max {
+			return 0, false
+		}
+		if after > wait {
+			wait = after
+		}
+	}
+	return wait, true
+}
+
+// errorMetadata returns the metadata of an error of the upstream: of an errorx error, also
+// sent as a grpc status by a grpc upstream, or else of a kratos error, e.g. decoded by
+// http.DefaultErrorDecoder rather than ErrorDecoder.
+func errorMetadata(err error) map[string]string {
+	if md := ecode.FromError(err).Metadata; md != nil {
+		return md
+	}
+	return kerrors.FromError(err).Metadata
+}
+
+func defaultRetryable(_ context.Context, idempotent bool, err error) bool {
+	if idempotent {
+		return ecode.IsRetryable(err)
+	}
+	if se := new(ecode.Error); errors.As(err, &se) {
+		return ecode.IsRetryable(se)
+	}
+	// only an errorx code sent by the upstream tells it rejected the request without
+	// processing it, not the grpc code alone
+	gs, ok := status.FromError(err)
+	if !ok {
+		return false
+	}
+	for _, detail := range gs.Details() {
+		if info, ok := detail.(*errdetails.ErrorInfo); ok && info.Domain == ecode.ErrorDomain {
+			return ecode.IsRetryable(ecode.FromGRPCStatus(gs))
+		}
+	}
+	return false
+}
+
+// rewindBody rewinds the body of an http request consumed by the previous attempt.
+func rewindBody(tr transport.Transporter) error {
+	ht, ok := tr.(http.Transporter)
+	if !ok || ht.Request() == nil || ht.Request().GetBody == nil {
+		return nil
+	}
+	body, err := ht.Request().GetBody()
+	if err != nil {
+		return err
+	}
+	ht.Request().Body = body
+	return nil
+}
+
+// resignKey is the context key of the signing of a request, run again by Retry before each retry.
+type resignKey struct{}
+
+// RetryBudget limits the retries of a client to a ratio of its requests in the last
+// 10 seconds, plus a minimum per second for low traffic, so a failing upstream is
+// not flooded with retries.
+type RetryBudget struct {
+	mu        sync.Mutex
+	ratio     float64
+	minPerSec int
+	buckets   [10]budgetBucket
+	now       func() time.Time
+}
+
+type budgetBucket struct {
+	second   int64
+	requests int
+	retries  int
+}
+
+// NewRetryBudget news a retry budget of ratio retries per request and minPerSecond retries per second.
+func NewRetryBudget(ratio float64, minPerSecond int) *RetryBudget {
+	return &RetryBudget{ratio: ratio, minPerSec: minPerSecond, now: time.Now}
+}
+
+func (b *RetryBudget) bucket() *budgetBucket {
+	sec := b.now().Unix()
+	bk := &b.buckets[sec%int64(len(b.buckets))]
+	if bk.second != sec {
+		*bk = budgetBucket{second: sec}
+	}
+	return bk
+}
+
+func (b *RetryBudget) request() {
+	b.mu.Lock()
+	b.bucket().requests++
+	b.mu.Unlock()
+}
+
+// retry withdraws a retry from the budget, false if it is spent.
+func (b *RetryBudget) retry() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	cur := b.bucket()
+	var requests, retries int
+	for _, bk := range b.buckets {
+		if cur.second-bk.second < int64(len(b.buckets)) {
+			requests += bk.requests
+			retries += bk.retries
+		}
+	}
+	if float64(retries) >= b.ratio*float64(requests)+float64(b.minPerSec*len(b.buckets)) {
+		return false
+	}
+	cur.retries++
+	return true
+}
@@ -0,0 +1,171 @@
+package kmid
+
+import (
+	"context"
+	"errors"
+	"io"
+	nethttp "net/http"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	authutil "github.com/XuThreeFire/goutil/authx"
+	errorutil "github.com/XuThreeFire/goutil/errorx"
+	limitutil "github.com/XuThreeFire/goutil/limitx"
+
+	kerrors "github.com/go-kratos/kratos/v2/errors"
+	"github.com/go-kratos/kratos/v2/middleware"
+	"github.com/go-kratos/kratos/v2/transport/http"
+	"google.golang.org/grpc/codes"
+	testpb "google.golang.org/grpc/interop/grpc_testing"
+	"google.golang.org/grpc/status"
+)
+
+// flaky fails the first n requests with err and counts the requests.
+func flaky(n int32, err error, calls *int32) middleware.Middleware {
+	return func(handler middleware.Handler) middleware.Handler {
+		return func(ctx context.Context, req interface{}) (interface{}, error) {
+			if atomic.AddInt32(calls, 1) <= n {
+				return nil, err
+			}
+			return handler(ctx, req)
+		}
+	}
+}
+
+func TestRetry(t *testing.T) {
+	users := map[string]struct{}{"user": {}}
+	sign := AuthGrpcClient("user", "key", authutil.WithNonce())
+	retry := Retry(WithBackoff(time.Millisecond, 10*time.Millisecond), WithIdempotent("/grpc.testing.TestService/EmptyCall"))
+	unavailable := status.Error(codes.Unavailable, "unavailable")
+	retryAfter := errorutil.ErrTooManyRequests.WithMetadata(map[string]string{limitutil.MetadataRetryAfter: "5"})
+	tests := []struct {
+		name      string
+		client    []middleware.Middleware
+		err       error
+		operation string
+		calls     int32
+		code      codes.Code
+	}{
+		{"resigned by retry", []middleware.Middleware{sign, retry}, errorutil.ErrOverloaded, "UnaryCall", 3, codes.OK},
+		{"signed per attempt", []middleware.Middleware{retry, sign}, errorutil.ErrOverloaded, "UnaryCall", 3, codes.OK},
+		{"not retryable", []middleware.Middleware{sign, retry}, errorutil.ErrIllegalRequest, "UnaryCall", 1, codes.InvalidArgument},
+		{"not idempotent", []middleware.Middleware{sign, retry}, unavailable, "UnaryCall", 1, codes.Unavailable},
+		{"idempotent", []middleware.Middleware{sign, retry}, unavailable, "EmptyCall", 3, codes.Unimplemented},
+		{"retry after over the max", []middleware.Middleware{sign, retry}, retryAfter, "UnaryCall", 1, codes.ResourceExhausted},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var calls int32
+			conn := dialTestService(t,
+				[]middleware.Middleware{AuthGrpc(users, "key", "", authutil.WithNonceRequired()), flaky(2, tt.err, &calls)},
+				tt.client,
+			)
+			client := testpb.NewTestServiceClient(conn)
+			var err error
+			if tt.operation == "EmptyCall" {
+				_, err = client.EmptyCall(context.Background(), &testpb.Empty{})
+			} else {
+				_, err = client.UnaryCall(context.Background(), &testpb.SimpleRequest{})
+			}
+			if status.Code(err) != tt.code || atomic.LoadInt32(&calls) != tt.calls {
+				t.Errorf("call = %v after %d attempts, want %v after %d", err, calls, tt.code, tt.calls)
+			}
+		})
+	}
+}
+
+func TestRetryHttp(t *testing.T) {
+	users := map[string]struct{}{"user": {}}
+	sign := AuthHttpClient("user", "key", authutil.WithNonce())
+	retry := Retry(WithBackoff(time.Millisecond, 10*time.Millisecond))
+	retryAfter := errorutil.ErrTooManyRequests.WithMetadata(map[string]string{limitutil.MetadataRetryAfter: "5"})
+	tests := []struct {
+		name    string
+		client  []middleware.Middleware
+		decoder http.DecodeErrorFunc
+		err     error
+		calls   int32
+		code    int32
+	}{
+		{"resigned by retry", []middleware.Middleware{sign, retry}, ErrorDecoder, errorutil.ErrOverloaded, 3, 0},
+		{"signed per attempt", []middleware.Middleware{retry, sign}, ErrorDecoder, errorutil.ErrOverloaded, 3, 0},
+		{"not retryable", []middleware.Middleware{sign, retry}, ErrorDecoder, errorutil.ErrIllegalRequest, 1, errorutil.ErrIllegalRequest.StatusCode},
+		{"retry after over the max", []middleware.Middleware{sign, retry}, ErrorDecoder, retryAfter, 1, errorutil.ErrTooManyRequests.StatusCode},
+		// the errorx code is lost, only the idempotent requests are retried
+		{"default decoder", []middleware.Middleware{sign, retry}, http.DefaultErrorDecoder, errorutil.ErrOverloaded, 1, errorutil.ErrOverloaded.StatusCode},
+		{"default decoder retry after", []middleware.Middleware{sign, Retry(WithBackoff(time.Millisecond, 10*time.Millisecond), WithIdempotent("/echo"))},
+			http.DefaultErrorDecoder, retryAfter, 1, errorutil.ErrTooManyRequests.StatusCode},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var calls int32
+			client := serveTestHTTP(t,
+				[]http.FilterFunc{AuthBodyFilter()},
+				[]middleware.Middleware{AuthHttp(users, "key", "", authutil.WithNonceRequired()), flaky(2, tt.err, &calls)},
+				http.WithMiddleware(tt.client...), http.WithErrorDecoder(tt.decoder),
+			)
+			reply, err := signedEcho(t, client, "", "", &testpb.SimpleRequest{Payload: &testpb.Payload{Body: []byte("payload")}})
+			var code int32
+			if err != nil {
+				code = errorutil.FromError(err).StatusCode
+				if ke := new(kerrors.Error); errors.As(err, &ke) {
+					code = FromKratosError(ke).StatusCode
+				}
+			}
+			if code != tt.code || atomic.LoadInt32(&calls) != tt.calls {
+				t.Fatalf("call = %v after %d attempts, want %d after %d", err, calls, tt.code, tt.calls)
+			}
+			if err == nil && string(reply.GetPayload().GetBody()) != "payload" {
+				t.Errorf("reply = %v, want the payload", reply)
+			}
+		})
+	}
+}
+
+func TestErrorDecoder(t *testing.T) {
+	res := &nethttp.Response{
+		StatusCode: nethttp.StatusTooManyRequests,
+		Header:     nethttp.Header{limitutil.HeaderRetryAfter: []string{"3"}},
+		Body:       io.NopCloser(strings.NewReader(`{"statusCode":111,"statusReason":"too many requests"}`)),
+	}
+	err := ErrorDecoder(context.Background(), res)
+	if se := errorutil.FromError(err); !errorutil.ErrTooManyRequests.Is(se) || se.Metadata[limitutil.MetadataRetryAfter] != "3" {
+		t.Errorf("ErrorDecoder() = %v %v, want ErrTooManyRequests retry after 3", err, se.Metadata)
+	}
+	if wait, ok := (&retryOptions{base: time.Millisecond, max: 10 * time.Second}).backoff(0, err); !ok || wait < 3*time.Second {
+		t.Errorf("backoff() = %v, %v, want the Retry-After", wait, ok)
+	}
+
+	// a response without the errorx body is mapped from its http status
+	res = &nethttp.Response{StatusCode: nethttp.StatusServiceUnavailable, Body: io.NopCloser(strings.NewReader("upstream down"))}
+	if err := ErrorDecoder(context.Background(), res); errorutil.GRPCCode(err) != codes.Unavailable || !errorutil.IsRetryable(err) {
+		t.Errorf("ErrorDecoder() = %v, want a retryable Unavailable", err)
+	}
+	if err := ErrorDecoder(context.Background(), &nethttp.Response{StatusCode: nethttp.StatusOK}); err != nil {
+		t.Errorf("ErrorDecoder() success = %v", err)
+	}
+}
+
+func TestRetryBudget(t *testing.T) {
+	now := time.Unix(1660000000, 0)
+	b := NewRetryBudget(0.5, 1)
+	b.now = func() time.Time { return now }
+	for i := 0; i < 10; i++ {
+		b.request()
+	}
+	// 10 retries of the minimum and 5 of the ratio
+	for i := 0; i < 15; i++ {
+		if !b.retry() {
+			t.Fatalf("retry() %d = false", i)
+		}
+	}
+	if b.retry() {
+		t.Error("retry() over budget = true")
+	}
+	now = now.Add(10 * time.Second)
+	if !b.retry() {
+		t.Error("retry() after the window = false")
+	}
+}
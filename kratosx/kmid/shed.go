@@ -0,0 +1,78 @@
+package kmid
+
+import (
+	"context"
+
+	ecode "github.com/XuThreeFire/goutil/errorx"
+	limitutil "github.com/XuThreeFire/goutil/limitx"
+
+	"github.com/go-kratos/kratos/v2/metrics"
+	"github.com/go-kratos/kratos/v2/middleware"
+	"github.com/go-kratos/kratos/v2/transport"
+)
+
+// ShedOption is load shedding option.
+type ShedOption func(*shedOptions)
+
+// WithPriorityFunc with the priority of the callers, limitutil.DefaultPriorities by default
+// where the grpc health checks are critical.
+func WithPriorityFunc(f limitutil.PriorityFunc) ShedOption {
+	return func(o *shedOptions) {
+		o.priority = f
+	}
+}
+
+// WithShedCounter with the counter of the rejected requests, labeled by operation and priority.
+func WithShedCounter(c metrics.Counter) ShedOption {
+	return func(o *shedOptions) {
+		o.rejected = c
+	}
+}
+
+// WithLimitGauge with the gauge of the concurrency limit, set as the requests complete.
+func WithLimitGauge(g metrics.Gauge) ShedOption {
+	return func(o *shedOptions) {
+		o.limit = g
+	}
+}
+
+type shedOptions struct {
+	priority limitutil.PriorityFunc
+	rejected metrics.Counter
+	limit    metrics.Gauge
+}
+
+// Shed is the server middleware shedding load with the adaptive concurrency limit of the limiter,
+// the counterpart of Breaker on the server side. The requests over the share of the limit of
+// their priority are rejected with errorx.ErrOverloaded, the low priority ones first.
+// Put it after the authentication middleware so the priority of the Auth-User applies.
+func Shed(l *limitutil.AdaptiveLimiter, opts ...ShedOption) middleware.Middleware {
+	o := &shedOptions{priority: limitutil.DefaultPriorities.Priority}
+	for _, opt := range opts {
+		opt(o)
+	}
+	return func(handler middleware.Handler) middleware.Handler {
+		return func(ctx context.Context, req interface{}) (reply interface{}, err error) {
+			tr, ok := transport.FromServerContext(ctx)
+			if !ok {
+				return nil, ecode.ErrInternalError
+			}
+			p := o.priority(callerFromContext(ctx, tr))
+			done, err := l.Acquire(p)
+			if err != nil {
+				if o.rejected != nil {
+					o.rejected.With(tr.Operation(), p.String()).Inc()
+				}
+				return nil, err
+			}
+			// deferred so a panicking handler, recovered by an outer middleware, is released
+			defer func() {
+				done(err)
+				if o.limit != nil {
+					o.limit.Set(float64(l.Limit()))
+				}
+			}()
+			return handler(ctx, req)
+		}
+	}
+}
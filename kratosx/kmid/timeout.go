@@ -0,0 +1,76 @@
+package kmid
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	ecode "github.com/XuThreeFire/goutil/errorx"
+	timeutil "github.com/XuThreeFire/goutil/timex"
+
+	"github.com/go-kratos/kratos/v2/middleware"
+	"github.com/go-kratos/kratos/v2/transport"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// Timeout is the server middleware applying the timeouts of the operations, shortened to the
+// remaining time of the caller sent by TimeoutClient in the X-Request-Timeout header.
+// The grpc-timeout of a grpc caller is already applied by grpc. A request which runs out of
+// time is rejected with errorx.ErrDeadlineExceeded.
+func Timeout(timeouts *timeutil.Timeouts) middleware.Middleware {
+	return func(handler middleware.Handler) middleware.Handler {
+		return func(ctx context.Context, req interface{}) (reply interface{}, err error) {
+			tr, ok := transport.FromServerContext(ctx)
+			if !ok {
+				return handler(ctx, req)
+			}
+			ctx, cancel := timeutil.WithTimeout(ctx, timeouts, tr.Operation(), tr.RequestHeader().Get(timeutil.HeaderRequestTimeout))
+			defer cancel()
+			reply, err = handler(ctx, req)
+			return reply, deadlineError(ctx, err)
+		}
+	}
+}
+
+// TimeoutClient is the client middleware applying the client timeouts of the operations, if any,
+// and forwarding the remaining time of the request in the X-Request-Timeout header so the
+// upstream does not work past it. A request which has run out of time is not sent and fails
+// with errorx.ErrDeadlineExceeded, like a request which runs out of time.
+func TimeoutClient(timeouts *timeutil.Timeouts) middleware.Middleware {
+	return func(handler middleware.Handler) middleware.Handler {
+		return func(ctx context.Context, req interface{}) (reply interface{}, err error) {
+			tr, ok := transport.FromClientContext(ctx)
+			if !ok {
+				return handler(ctx, req)
+			}
+			ctx, cancel := timeutil.WithTimeout(ctx, timeouts, tr.Operation(), "")
+			defer cancel()
+			if deadline, ok := ctx.Deadline(); ok {
+				remaining := time.Until(deadline)
+				if remaining <= 0 {
+					return nil, ecode.ErrDeadlineExceeded
+				}
+				tr.RequestHeader().Set(timeutil.HeaderRequestTimeout, timeutil.FormatTimeout(remaining))
+			}
+			reply, err = handler(ctx, req)
+			return reply, deadlineError(ctx, err)
+		}
+	}
+}
+
+// deadlineError maps the errors of a request which ran out of time to ErrDeadlineExceeded,
+// the errorx errors are kept.
+func deadlineError(ctx context.Context, err error) error {
+	if err == nil {
+		return nil
+	}
+	if se := new(ecode.Error); errors.As(err, &se) {
+		return err
+	}
+	if errors.Is(ctx.Err(), context.DeadlineExceeded) || errors.Is(err, context.DeadlineExceeded) ||
+		status.Code(err) == codes.DeadlineExceeded {
+		return ecode.ErrDeadlineExceeded.WithCause(err)
+	}
+	return err
+}
@@ -0,0 +1,64 @@
+package kmid
+
+import (
+	"context"
+	"strconv"
+	"testing"
+	"time"
+
+	errorutil "github.com/XuThreeFire/goutil/errorx"
+	timeutil "github.com/XuThreeFire/goutil/timex"
+
+	"github.com/go-kratos/kratos/v2/middleware"
+	"github.com/go-kratos/kratos/v2/transport"
+	"google.golang.org/grpc/codes"
+	testpb "google.golang.org/grpc/interop/grpc_testing"
+	"google.golang.org/grpc/status"
+)
+
+func TestTimeout(t *testing.T) {
+	headers := make(chan string, 1)
+	// slow waits for the deadline of the request and records the forwarded timeout
+	slow := func(handler middleware.Handler) middleware.Handler {
+		return func(ctx context.Context, req interface{}) (interface{}, error) {
+			if tr, ok := transport.FromServerContext(ctx); ok {
+				headers <- tr.RequestHeader().Get(timeutil.HeaderRequestTimeout)
+			}
+			<-ctx.Done()
+			return nil, ctx.Err()
+		}
+	}
+	timeouts := &timeutil.Timeouts{Operations: map[string]time.Duration{
+		"/grpc.testing.TestService/UnaryCall": 50 * time.Millisecond,
+	}}
+	conn := dialTestService(t, []middleware.Middleware{Timeout(timeouts), slow}, []middleware.Middleware{TimeoutClient(nil)})
+	client := testpb.NewTestServiceClient(conn)
+
+	start := time.Now()
+	_, err := client.UnaryCall(context.Background(), &testpb.SimpleRequest{})
+	if status.Code(err) != codes.DeadlineExceeded || !errorutil.ErrDeadlineExceeded.Is(errorutil.FromError(err)) {
+		t.Errorf("UnaryCall() = %v, want errorx deadline exceeded", err)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("UnaryCall() took %v, want the operation timeout", elapsed)
+	}
+	// the kratos client applies its default 2s timeout
+	if ms, _ := strconv.Atoi(<-headers); ms <= 1900 || ms > 2000 {
+		t.Errorf("%s = %d, want the client timeout", timeutil.HeaderRequestTimeout, ms)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	if _, err := client.UnaryCall(ctx, &testpb.SimpleRequest{}); status.Code(err) != codes.DeadlineExceeded {
+		t.Errorf("UnaryCall() with client deadline = %v", err)
+	}
+	if ms, _ := strconv.Atoi(<-headers); ms <= 900 || ms > 1000 {
+		t.Errorf("%s = %d, want the remaining time", timeutil.HeaderRequestTimeout, ms)
+	}
+
+	expired, cancel := context.WithDeadline(context.Background(), time.Now().Add(-time.Second))
+	defer cancel()
+	if _, err := client.UnaryCall(expired, &testpb.SimpleRequest{}); status.Code(err) != codes.DeadlineExceeded {
+		t.Errorf("UnaryCall() expired = %v", err)
+	}
+}
@@ -13,7 +13,7 @@ import (
 )
 
 var ServerHandler HandlerFunc = func(ctx context.Context, req, err interface{}) error {
-	return ecode.ErrInternalError.AddMsg(fmt.Sprintf("%+v", err))
+	return ecode.ErrInternalError.WithMessage(fmt.Sprintf("%+v", err))
 }
 
 // HandlerFunc is recovery handler func.
@@ -0,0 +1,286 @@
+package limitutil
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	errorutil "github.com/XuThreeFire/goutil/errorx"
+
+	"google.golang.org/grpc/codes"
+)
+
+const (
+	// DefaultInitialLimit is the initial concurrency limit of an adaptive limiter.
+	DefaultInitialLimit = 20
+	// DefaultMinLimit is the lowest concurrency limit of an adaptive limiter.
+	DefaultMinLimit = 1
+	// DefaultMaxLimit is the highest concurrency limit of an adaptive limiter.
+	DefaultMaxLimit = 1000
+	// DefaultRTTWindow is how long the no-load latency is kept before it moves toward the
+	// lowest latency measured since.
+	DefaultRTTWindow = 30 * time.Second
+)
+
+// Priority is the priority class of a request, the lower classes are shed first.
+type Priority int
+
+const (
+	// PriorityLow batch and background requests.
+	PriorityLow Priority = iota
+	// PriorityNormal the default.
+	PriorityNormal
+	// PriorityHigh premium callers.
+	PriorityHigh
+	// PriorityCritical health checks, shed last.
+	PriorityCritical
+)
+
+var priorityNames = [...]string{"low", "normal", "high", "critical"}
+
+// String returns the name of the priority.
+func (p Priority) String() string {
+	if p < PriorityLow || p > PriorityCritical {
+		return "unknown"
+	}
+	return priorityNames[p]
+}
+
+// MarshalText encodes the name of the priority.
+func (p Priority) MarshalText() ([]byte, error) {
+	return []byte(p.String()), nil
+}
+
+// UnmarshalText decodes a priority from its name, e.g. "critical", or number.
+func (p *Priority) UnmarshalText(text []byte) error {
+	for i, name := range priorityNames {
+		if strings.EqualFold(string(text), name) {
+			*p = Priority(i)
+			return nil
+		}
+	}
+	n, err := strconv.Atoi(string(text))
+	if err != nil || Priority(n) < PriorityLow || Priority(n) > PriorityCritical {
+		return fmt.Errorf("limitx: unknown priority %q", text)
+	}
+	*p = Priority(n)
+	return nil
+}
+
+// share is the fraction of the concurrency limit the requests of a priority may use,
+// so when the service saturates the low priority requests are shed before the others.
+func (p Priority) share() float64 {
+	switch p {
+	case PriorityLow:
+		return 0.7
+	case PriorityNormal:
+		return 0.9
+	case PriorityHigh:
+		return 1
+	}
+	return 1.5
+}
+
+// PriorityFunc returns the priority of the caller.
+type PriorityFunc func(c Caller) Priority
+
+// Priorities are the priorities of the users and operations, the higher of both applies,
+// PriorityNormal if neither is set:
+//
+//	operations:
+//	  /grpc.health.v1.Health/Check: critical
+//	users:
+//	  partner-a: high
+type Priorities struct {
+	Users      map[string]Priority `yaml:"users" json:"users"`
+	Operations map[string]Priority `yaml:"operations" json:"operations"`
+}
+
+// DefaultPriorities are the priorities with the grpc health checks critical.
+var DefaultPriorities = &Priorities{Operations: map[string]Priority{
+	"/grpc.health.v1.Health/Check": PriorityCritical,
+	"/grpc.health.v1.Health/Watch": PriorityCritical,
+}}
+
+// Priority returns the priority of the caller.
+func (p *Priorities) Priority(c Caller) Priority {
+	user, uok := p.Users[c.User]
+	op, ook := p.Operations[c.Operation]
+	switch {
+	case uok && ook:
+		if user > op {
+			return user
+		}
+		return op
+	case uok:
+		return user
+	case ook:
+		return op
+	}
+	return PriorityNormal
+}
+
+// AdaptiveLimiter limits the in-flight requests of a service to a concurrency limit adapted
+// to the latency, in the way of TCP Vegas: the limit grows while the latency stays near
+// the no-load latency and shrinks when requests queue up, so the service sheds load
+// instead of falling over when it saturates.
+type AdaptiveLimiter struct {
+	rejected [PriorityCritical + 1]uint64 // first for the 64-bit alignment of atomic
+
+	mu        sync.Mutex
+	inflight  int
+	limit     float64
+	minLimit  float64
+	maxLimit  float64
+	minRTT    time.Duration
+	windowRTT time.Duration // lowest latency of the current window
+	rttWindow time.Duration
+	rttReset  time.Time
+	now       func() time.Time
+}
+
+// AdaptiveOption is adaptive limiter option.
+type AdaptiveOption func(*AdaptiveLimiter)
+
+// WithLimits with the initial, lowest and highest concurrency limits,
+// DefaultInitialLimit, DefaultMinLimit and DefaultMaxLimit by default.
+func WithLimits(initial, min, max int) AdaptiveOption {
+	return func(l *AdaptiveLimiter) {
+		l.limit, l.minLimit, l.maxLimit = float64(initial), float64(min), float64(max)
+	}
+}
+
+// WithRTTWindow with how long the no-load latency is kept before it moves halfway to the
+// lowest latency of the window, DefaultRTTWindow by default.
+func WithRTTWindow(d time.Duration) AdaptiveOption {
+	return func(l *AdaptiveLimiter) {
+		l.rttWindow = d
+	}
+}
+
+// NewAdaptiveLimiter news an adaptive limiter.
+func NewAdaptiveLimiter(opts ...AdaptiveOption) *AdaptiveLimiter {
+	l := &AdaptiveLimiter{
+		limit:     DefaultInitialLimit,
+		minLimit:  DefaultMinLimit,
+		maxLimit:  DefaultMaxLimit,
+		rttWindow: DefaultRTTWindow,
+		now:       time.Now,
+	}
+	for _, o := range opts {
+		o(l)
+	}
+	return l
+}
+
+// Acquire admits a request of the priority, it returns ErrOverloaded if the in-flight requests
+// reached the share of the limit of the priority. Call done with the error of an admitted
+// request once it completes, the latency of the successful ones adapts the limit and the
+// overload errors shrink it, see overloaded.
+func (l *AdaptiveLimiter) Acquire(p Priority) (done func(err error), err error) {
+	if p < PriorityLow {
+		p = PriorityLow
+	} else if p > PriorityCritical {
+		p = PriorityCritical
+	}
+	l.mu.Lock()
+	if float64(l.inflight) >= math.Max(1, l.limit*p.share()) {
+		l.mu.Unlock()
+		atomic.AddUint64(&l.rejected[p], 1)
+		return nil, errorutil.ErrOverloaded
+	}
+	l.inflight++
+	inflight := l.inflight
+	l.mu.Unlock()
+
+	start := l.now()
+	return func(err error) {
+		l.release(inflight, l.now().Sub(start), err)
+	}, nil
+}
+
+func (l *AdaptiveLimiter) release(inflight int, rtt time.Duration, err error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.inflight--
+	if err != nil {
+		if overloaded(err) {
+			l.setLimit(l.limit * 0.9)
+		}
+		return
+	}
+	now := l.now()
+	if l.windowRTT == 0 || rtt < l.windowRTT {
+		l.windowRTT = rtt
+	}
+	if l.minRTT == 0 || rtt < l.minRTT {
+		l.minRTT = rtt
+	} else if now.After(l.rttReset) {
+		// the no-load latency may have risen, but the samples of a loaded service are not
+		// the no-load latency: decay toward the lowest of the window instead of taking one
+		l.minRTT += (l.windowRTT - l.minRTT) / 2
+	}
+	if now.After(l.rttReset) {
+		l.rttReset = now.Add(l.rttWindow)
+		l.windowRTT = 0
+	}
+	if l.minRTT <= 0 {
+		return
+	}
+	// queue is the estimated requests waiting rather than being served
+	queue := l.limit * (1 - float64(l.minRTT)/float64(rtt))
+	step := math.Max(1, math.Log10(l.limit))
+	switch {
+	case queue > 6*step:
+		l.setLimit(l.limit - step)
+	case queue < 3*step && float64(inflight) >= l.limit/2:
+		// only grow when the limit is used, not when the service is idle
+		l.setLimit(l.limit + step)
+	}
+}
+
+func (l *AdaptiveLimiter) setLimit(limit float64) {
+	l.limit = math.Min(l.maxLimit, math.Max(l.minLimit, limit))
+}
+
+// Limit returns the current concurrency limit.
+func (l *AdaptiveLimiter) Limit() int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return int(l.limit)
+}
+
+// InFlight returns the in-flight requests.
+func (l *AdaptiveLimiter) InFlight() int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.inflight
+}
+
+// Rejected returns the number of rejected requests of the priority.
+func (l *AdaptiveLimiter) Rejected(p Priority) uint64 {
+	if p < PriorityLow || p > PriorityCritical {
+		return 0
+	}
+	return atomic.LoadUint64(&l.rejected[p])
+}
+
+// overloaded reports whether err signals an overload, a deadline exceeded or an unavailable
+// service, e.g. ErrDeadlineExceeded and ErrOverloaded. The other server faults, such as a
+// plain or database error, say nothing about the load and leave the limit unchanged.
+func overloaded(err error) bool {
+	if errors.Is(err, context.DeadlineExceeded) {
+		return true
+	}
+	switch errorutil.GRPCCode(err) {
+	case codes.DeadlineExceeded, codes.Unavailable:
+		return true
+	}
+	return false
+}
@@ -0,0 +1,167 @@
+package limitutil
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	errorutil "github.com/XuThreeFire/goutil/errorx"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"gopkg.in/yaml.v3"
+)
+
+func TestAdaptiveLimiterPriorities(t *testing.T) {
+	l := NewAdaptiveLimiter(WithLimits(10, 1, 100))
+	var dones []func(error)
+	for i := 0; i < 7; i++ {
+		done, err := l.Acquire(PriorityLow)
+		if err != nil {
+			t.Fatalf("Acquire() low %d = %v", i, err)
+		}
+		dones = append(dones, done)
+	}
+	if _, err := l.Acquire(PriorityLow); !errorutil.ErrOverloaded.Is(err) {
+		t.Errorf("Acquire() low over its share = %v", err)
+	}
+	for i := 0; i < 3; i++ {
+		done, err := l.Acquire(PriorityHigh)
+		if err != nil {
+			t.Fatalf("Acquire() high %d = %v", i, err)
+		}
+		dones = append(dones, done)
+	}
+	if _, err := l.Acquire(PriorityNormal); err == nil {
+		t.Error("Acquire() normal over the limit = nil")
+	}
+	if _, err := l.Acquire(PriorityCritical); err != nil {
+		t.Errorf("Acquire() critical = %v, want admitted over the limit", err)
+	}
+	if l.Rejected(PriorityLow) != 1 || l.Rejected(PriorityNormal) != 1 || l.InFlight() != 11 {
+		t.Errorf("rejected low %d, normal %d, in flight %d", l.Rejected(PriorityLow), l.Rejected(PriorityNormal), l.InFlight())
+	}
+	for _, done := range dones {
+		done(nil)
+	}
+	if l.InFlight() != 1 {
+		t.Errorf("InFlight() = %d after done, want 1", l.InFlight())
+	}
+}
+
+func TestAdaptiveLimiterLimit(t *testing.T) {
+	now := time.Unix(1660000000, 0)
+	l := NewAdaptiveLimiter(WithLimits(10, 2, 20))
+	l.now = func() time.Time { return now }
+	run := func(n int, rtt time.Duration, err error) {
+		var dones []func(error)
+		for i := 0; i < n; i++ {
+			if done, e := l.Acquire(PriorityHigh); e == nil {
+				dones = append(dones, done)
+			}
+		}
+		now = now.Add(rtt)
+		for _, done := range dones {
+			done(err)
+		}
+	}
+
+	// no queueing at the no-load latency, the limit grows while it is used
+	for i := 0; i < 5; i++ {
+		run(10, 10*time.Millisecond, nil)
+	}
+	grown := l.Limit()
+	if grown <= 10 {
+		t.Fatalf("Limit() = %d, want grown", grown)
+	}
+	// the latency doubles as requests queue up, the limit shrinks
+	for i := 0; i < 20; i++ {
+		run(grown, 20*time.Millisecond, nil)
+	}
+	if l.Limit() >= grown {
+		t.Errorf("Limit() = %d with queueing, want < %d", l.Limit(), grown)
+	}
+	// the business and internal errors say nothing about the load
+	limit := l.Limit()
+	for _, err := range []error{errorutil.ErrInternalError, errors.New("record not found"), errorutil.ErrTooManyRequests} {
+		run(1, time.Millisecond, err)
+		if l.Limit() != limit {
+			t.Errorf("Limit() = %d after %v, want %d", l.Limit(), err, limit)
+		}
+	}
+	for _, err := range []error{errorutil.ErrOverloaded, errorutil.ErrDeadlineExceeded, context.DeadlineExceeded, status.Error(codes.Unavailable, "unavailable")} {
+		run(1, time.Millisecond, err)
+		if l.Limit() >= limit {
+			t.Errorf("Limit() = %d after %v, want < %d", l.Limit(), err, limit)
+		}
+		limit = l.Limit()
+	}
+	for i := 0; i < 50; i++ {
+		run(1, time.Millisecond, errorutil.ErrOverloaded)
+	}
+	if l.Limit() != 2 {
+		t.Errorf("Limit() = %d after overloads, want the min 2", l.Limit())
+	}
+}
+
+func TestAdaptiveLimiterRTTWindow(t *testing.T) {
+	now := time.Unix(1660000000, 0)
+	l := NewAdaptiveLimiter(WithLimits(20, 2, 40), WithRTTWindow(time.Second))
+	l.now = func() time.Time { return now }
+	run := func(rtt time.Duration) {
+		var dones []func(error)
+		for {
+			done, err := l.Acquire(PriorityHigh)
+			if err != nil {
+				break
+			}
+			dones = append(dones, done)
+		}
+		now = now.Add(rtt)
+		for _, done := range dones {
+			done(nil)
+		}
+	}
+
+	run(10 * time.Millisecond)
+	// the latency stays high across a window reset, the limit must not grow back
+	last := l.Limit()
+	for now.Before(time.Unix(1660000001, 500*int64(time.Millisecond))) {
+		run(100 * time.Millisecond)
+		if l.Limit() > last {
+			t.Fatalf("Limit() grew to %d at %v with the latency high", l.Limit(), now)
+		}
+		last = l.Limit()
+	}
+	if l.minRTT >= 100*time.Millisecond {
+		t.Errorf("minRTT = %v, want below the loaded latency", l.minRTT)
+	}
+}
+
+func TestPriorities(t *testing.T) {
+	var p Priorities
+	err := yaml.Unmarshal([]byte(`
+operations: {/grpc.health.v1.Health/Check: critical, Export: 0}
+users: {partner-a: high}
+`), &p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		caller Caller
+		want   Priority
+	}{
+		{Caller{User: "partner-a", Operation: "Query"}, PriorityHigh},
+		{Caller{User: "partner-a", Operation: "/grpc.health.v1.Health/Check"}, PriorityCritical},
+		{Caller{User: "partner-b", Operation: "Export"}, PriorityLow},
+		{Caller{User: "partner-b", Operation: "Query"}, PriorityNormal},
+	}
+	for _, tt := range tests {
+		if got := p.Priority(tt.caller); got != tt.want {
+			t.Errorf("Priority(%+v) = %s, want %s", tt.caller, got, tt.want)
+		}
+	}
+	if err := yaml.Unmarshal([]byte(`users: {a: urgent}`), &p); err == nil {
+		t.Error("Unmarshal() unknown priority = nil")
+	}
+}
@@ -0,0 +1,143 @@
+package limitutil
+
+import (
+	"context"
+	"math"
+	"sync"
+	"time"
+)
+
+// DefaultSweepInterval is the interval the local backends evict their idle keys at.
+const DefaultSweepInterval = time.Minute
+
+// Backend keeps the limiter state of the keys. The local backends keep it in memory,
+// a distributed backend, e.g. on Redis, shares it between the instances of a service.
+type Backend interface {
+	// Take takes a request of the key under the quota at now, it returns whether the request
+	// is allowed and, if not, how long to wait before a request of the key may be allowed.
+	Take(ctx context.Context, key string, q Quota, now time.Time) (ok bool, retryAfter time.Duration, err error)
+}
+
+// TokenBucket is a local Backend where a key has a bucket of Burst tokens refilled
+// at Limit per Period, a request takes a token. It allows bursts up to the bucket size.
+type TokenBucket struct {
+	mu        sync.Mutex
+	buckets   map[string]*bucket
+	lastSweep time.Time
+}
+
+type bucket struct {
+	tokens float64
+	last   time.Time
+	idle   time.Duration
+}
+
+// NewTokenBucket news a local token bucket backend.
+func NewTokenBucket() *TokenBucket {
+	return &TokenBucket{buckets: make(map[string]*bucket)}
+}
+
+// Take takes a token of the bucket of the key.
+func (b *TokenBucket) Take(_ context.Context, key string, q Quota, now time.Time) (bool, time.Duration, error) {
+	rate := float64(q.Limit) / float64(q.Period) // tokens per nanosecond
+	burst := float64(q.burst())
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.sweep(now)
+	bk, ok := b.buckets[key]
+	if !ok {
+		bk = &bucket{tokens: burst, last: now}
+		b.buckets[key] = bk
+	}
+	// the time the bucket takes to refill is how long a key is kept after its last request
+	bk.idle = time.Duration(burst / rate)
+	if elapsed := now.Sub(bk.last); elapsed > 0 {
+		bk.tokens = math.Min(burst, bk.tokens+float64(elapsed)*rate)
+		bk.last = now
+	}
+	if bk.tokens >= 1 {
+		bk.tokens--
+		return true, 0, nil
+	}
+	return false, time.Duration(math.Ceil((1 - bk.tokens) / rate)), nil
+}
+
+func (b *TokenBucket) sweep(now time.Time) {
+	if now.Sub(b.lastSweep) < DefaultSweepInterval {
+		return
+	}
+	b.lastSweep = now
+	for key, bk := range b.buckets {
+		if now.Sub(bk.last) > bk.idle {
+			delete(b.buckets, key)
+		}
+	}
+}
+
+// SlidingWindow is a local Backend allowing Limit requests of a key in any Period.
+// It estimates the requests of the sliding window from the counts of the current and
+// previous fixed windows, so unlike a fixed window it does not allow twice the limit
+// across a window boundary.
+type SlidingWindow struct {
+	mu        sync.Mutex
+	windows   map[string]*window
+	lastSweep time.Time
+}
+
+type window struct {
+	start  time.Time
+	count  int
+	prev   int
+	period time.Duration
+}
+
+// NewSlidingWindow news a local sliding window backend.
+func NewSlidingWindow() *SlidingWindow {
+	return &SlidingWindow{windows: make(map[string]*window)}
+}
+
+// Take counts a request in the window of the key if the estimated count is under the limit.
+func (s *SlidingWindow) Take(_ context.Context, key string, q Quota, now time.Time) (bool, time.Duration, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.sweep(now)
+	w, ok := s.windows[key]
+	if !ok {
+		w = &window{start: now.Truncate(q.Period)}
+		s.windows[key] = w
+	}
+	w.period = q.Period
+	if elapsed := now.Sub(w.start); elapsed >= q.Period {
+		// the previous window is the current one if it has just ended, empty otherwise
+		if elapsed < 2*q.Period {
+			w.prev = w.count
+		} else {
+			w.prev = 0
+		}
+		w.start, w.count = now.Truncate(q.Period), 0
+	}
+	weight := 1 - float64(now.Sub(w.start))/float64(q.Period)
+	if float64(w.prev)*weight+float64(w.count) < float64(q.Limit) {
+		w.count++
+		return true, 0, nil
+	}
+	// a request may be allowed once enough of the previous window slid out, or the current one ended
+	retryAfter := w.start.Add(q.Period).Sub(now)
+	if w.prev > 0 && w.count < q.Limit {
+		excess := float64(w.prev)*weight + float64(w.count) + 1 - float64(q.Limit)
+		retryAfter = time.Duration(math.Ceil(excess / float64(w.prev) * float64(q.Period)))
+	}
+	return false, retryAfter, nil
+}
+
+func (s *SlidingWindow) sweep(now time.Time) {
+	if now.Sub(s.lastSweep) < DefaultSweepInterval {
+		return
+	}
+	s.lastSweep = now
+	for key, w := range s.windows {
+		if now.Sub(w.start) >= 2*w.period {
+			delete(s.windows, key)
+		}
+	}
+}
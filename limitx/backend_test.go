@@ -0,0 +1,66 @@
+package limitutil
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestTokenBucket(t *testing.T) {
+	ctx := context.Background()
+	b := NewTokenBucket()
+	q := Quota{Limit: 10, Period: time.Second, Burst: 2}
+	now := time.Unix(1660000000, 0)
+	for i := 0; i < 2; i++ {
+		if ok, _, _ := b.Take(ctx, "a", q, now); !ok {
+			t.Fatalf("Take() %d within burst = false", i)
+		}
+	}
+	ok, retryAfter, _ := b.Take(ctx, "a", q, now)
+	if ok || retryAfter != 100*time.Millisecond {
+		t.Errorf("Take() over burst = %v, %v, want false, 100ms", ok, retryAfter)
+	}
+	if ok, _, _ := b.Take(ctx, "b", q, now); !ok {
+		t.Error("Take() of another key = false")
+	}
+	if ok, _, _ := b.Take(ctx, "a", q, now.Add(100*time.Millisecond)); !ok {
+		t.Error("Take() after refill = false")
+	}
+
+	// idle keys are evicted
+	b.Take(ctx, "c", q, now.Add(2*DefaultSweepInterval))
+	if len(b.buckets) != 1 {
+		t.Errorf("buckets = %d after sweep, want 1", len(b.buckets))
+	}
+}
+
+func TestSlidingWindow(t *testing.T) {
+	ctx := context.Background()
+	s := NewSlidingWindow()
+	q := PerSecond(4)
+	start := time.Unix(1660000000, 0)
+	for i := 0; i < 4; i++ {
+		if ok, _, _ := s.Take(ctx, "a", q, start.Add(900*time.Millisecond)); !ok {
+			t.Fatalf("Take() %d within limit = false", i)
+		}
+	}
+	ok, retryAfter, _ := s.Take(ctx, "a", q, start.Add(900*time.Millisecond))
+	if ok || retryAfter != 100*time.Millisecond {
+		t.Errorf("Take() over limit = %v, %v, want false, 100ms", ok, retryAfter)
+	}
+	// unlike a fixed window the previous requests still count just after the boundary
+	if ok, _, _ := s.Take(ctx, "a", q, start.Add(1100*time.Millisecond)); !ok {
+		t.Error("Take() after the window boundary = false")
+	}
+	ok, retryAfter, _ = s.Take(ctx, "a", q, start.Add(1100*time.Millisecond))
+	if ok || retryAfter != 400*time.Millisecond {
+		t.Errorf("Take() with the previous window counted = %v, %v, want false, 400ms", ok, retryAfter)
+	}
+	ok, retryAfter, _ = s.Take(ctx, "a", q, start.Add(1500*time.Millisecond))
+	if !ok {
+		t.Errorf("Take() with half the previous window = false, retry after %v", retryAfter)
+	}
+	if ok, _, _ := s.Take(ctx, "a", q, start.Add(3*time.Second)); !ok {
+		t.Error("Take() after idle windows = false")
+	}
+}
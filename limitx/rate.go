@@ -0,0 +1,232 @@
+// Package limitutil limits the requests of the callers of a service, it is the
+// transport agnostic core of the limiter middlewares of kmid and midutil.
+package limitutil
+
+import (
+	"context"
+	"net"
+	"strconv"
+	"sync"
+	"time"
+
+	errorutil "github.com/XuThreeFire/goutil/errorx"
+
+	"github.com/go-kratos/kratos/v2/log"
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	// HeaderRetryAfter is the reply header of the seconds to wait before retrying a limited request.
+	HeaderRetryAfter = "Retry-After"
+	// MetadataRetryAfter is the errorx metadata key of the seconds to wait before retrying a limited request.
+	MetadataRetryAfter = "retry_after"
+)
+
+// Quota is Limit requests per Period, Burst is the bucket size of the token bucket and
+// defaults to Limit. A zero quota is unlimited.
+type Quota struct {
+	Limit  int           `yaml:"limit" json:"limit"`
+	Period time.Duration `yaml:"period" json:"period"`
+	Burst  int           `yaml:"burst,omitempty" json:"burst,omitempty"`
+}
+
+// PerSecond is a quota of n requests per second.
+func PerSecond(n int) Quota {
+	return Quota{Limit: n, Period: time.Second}
+}
+
+// PerMinute is a quota of n requests per minute.
+func PerMinute(n int) Quota {
+	return Quota{Limit: n, Period: time.Minute}
+}
+
+// Unlimited reports whether the quota does not limit.
+func (q Quota) Unlimited() bool {
+	return q.Limit <= 0 || q.Period <= 0
+}
+
+func (q Quota) burst() int {
+	if q.Burst > 0 {
+		return q.Burst
+	}
+	return q.Limit
+}
+
+// Quotas are the quotas of the callers, the quota of a user takes precedence
+// over the quota of an operation, which takes precedence over the default.
+// The quota of an operation is counted apart from the other operations of the caller:
+//
+//	default: {limit: 100, period: 1s}
+//	users:
+//	  partner-a: {limit: 1000, period: 1s, burst: 2000}
+//	operations:
+//	  /api.order.v1.Order/Export: {limit: 10, period: 1m}
+type Quotas struct {
+	Default    Quota            `yaml:"default" json:"default"`
+	Users      map[string]Quota `yaml:"users" json:"users"`
+	Operations map[string]Quota `yaml:"operations" json:"operations"`
+}
+
+// ParseQuotas parses YAML (or JSON) quotas, the periods are durations like "1s" or "1m".
+func ParseQuotas(data []byte) (*Quotas, error) {
+	q := new(Quotas)
+	if err := yaml.Unmarshal(data, q); err != nil {
+		return nil, err
+	}
+	return q, nil
+}
+
+// Quota returns the quota of the caller.
+func (q *Quotas) Quota(c Caller) Quota {
+	quota, _ := q.quota(c)
+	return quota
+}
+
+// quota returns the quota of the caller and whether it is the quota of its operation.
+func (q *Quotas) quota(c Caller) (Quota, bool) {
+	if q == nil {
+		return Quota{}, false
+	}
+	if quota, ok := q.Users[c.User]; ok && c.User != "" {
+		return quota, false
+	}
+	if quota, ok := q.Operations[c.Operation]; ok {
+		return quota, true
+	}
+	return q.Default, false
+}
+
+// Caller is the caller of a request: its Auth-User (or bearer token user), the operation
+// and the client address ("host" or "host:port").
+type Caller struct {
+	User      string
+	Operation string
+	Addr      string
+}
+
+// IP returns the host of the caller address.
+func (c Caller) IP() string {
+	if host, _, err := net.SplitHostPort(c.Addr); err == nil {
+		return host
+	}
+	return c.Addr
+}
+
+// KeyFunc returns the limiter key of the caller, the callers of a key share its quota.
+type KeyFunc func(c Caller) string
+
+// ByUser keys the callers by user, callers without user by client IP. It is the default.
+func ByUser(c Caller) string {
+	if c.User == "" {
+		return "ip:" + c.IP()
+	}
+	return "user:" + c.User
+}
+
+// ByOperation keys the callers by operation, the quota is shared by all the callers of an operation.
+func ByOperation(c Caller) string {
+	return "op:" + c.Operation
+}
+
+// ByIP keys the callers by client IP.
+func ByIP(c Caller) string {
+	return "ip:" + c.IP()
+}
+
+// ByUserOperation keys the callers by user and operation, each user has a quota per operation.
+func ByUserOperation(c Caller) string {
+	return ByUser(c) + "|" + c.Operation
+}
+
+// RateLimiter limits the rate of the requests of the callers. It is safe for concurrent use
+// and its quotas can be replaced at run time.
+type RateLimiter struct {
+	mu      sync.RWMutex
+	quotas  *Quotas
+	backend Backend
+	keyFunc KeyFunc
+	logger  log.Logger
+	now     func() time.Time
+}
+
+// RateLimiterOption is rate limiter option.
+type RateLimiterOption func(*RateLimiter)
+
+// WithBackend with the backend of the limiter, a local TokenBucket by default.
+func WithBackend(b Backend) RateLimiterOption {
+	return func(l *RateLimiter) {
+		l.backend = b
+	}
+}
+
+// WithKeyFunc with the key of the callers, ByUser by default.
+func WithKeyFunc(f KeyFunc) RateLimiterOption {
+	return func(l *RateLimiter) {
+		l.keyFunc = f
+	}
+}
+
+// WithLogger with the logger of the backend errors, the global logger by default.
+func WithLogger(logger log.Logger) RateLimiterOption {
+	return func(l *RateLimiter) {
+		l.logger = logger
+	}
+}
+
+// NewRateLimiter news a rate limiter of the quotas.
+func NewRateLimiter(quotas *Quotas, opts ...RateLimiterOption) *RateLimiter {
+	l := &RateLimiter{
+		quotas:  quotas,
+		backend: NewTokenBucket(),
+		keyFunc: ByUser,
+		logger:  log.GetLogger(),
+		now:     time.Now,
+	}
+	for _, o := range opts {
+		o(l)
+	}
+	return l
+}
+
+// SetQuotas replaces the quotas.
+func (l *RateLimiter) SetQuotas(q *Quotas) {
+	l.mu.Lock()
+	l.quotas = q
+	l.mu.Unlock()
+}
+
+// Allow returns ErrTooManyRequests with the MetadataRetryAfter seconds if the caller exceeded its quota.
+// A backend error is logged and the request allowed, the limiter fails open.
+func (l *RateLimiter) Allow(ctx context.Context, c Caller) error {
+	l.mu.RLock()
+	q, byOperation := l.quotas.quota(c)
+	l.mu.RUnlock()
+	if q.Unlimited() {
+		return nil
+	}
+	key := l.keyFunc(c)
+	if byOperation {
+		// a bucket of its own, not the bucket of the other operations of the key
+		key += "@" + c.Operation
+	}
+	ok, retryAfter, err := l.backend.Take(ctx, key, q, l.now())
+	if err != nil {
+		log.NewHelper(l.logger).WithContext(ctx).Errorw(
+			"msg", "rate limiter backend failed",
+			"key", key,
+			"err", err,
+		)
+		return nil
+	}
+	if ok {
+		return nil
+	}
+	return errorutil.ErrTooManyRequests.WithMetadata(map[string]string{
+		MetadataRetryAfter: strconv.Itoa(RetryAfterSeconds(retryAfter)),
+	})
+}
+
+// RetryAfterSeconds rounds the wait up to whole seconds, the unit of the Retry-After header.
+func RetryAfterSeconds(d time.Duration) int {
+	return int((d + time.Second - 1) / time.Second)
+}
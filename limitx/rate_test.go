@@ -0,0 +1,138 @@
+package limitutil
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	errorutil "github.com/XuThreeFire/goutil/errorx"
+	"github.com/go-kratos/kratos/v2/log"
+)
+
+type failingBackend struct{}
+
+func (failingBackend) Take(context.Context, string, Quota, time.Time) (bool, time.Duration, error) {
+	return false, 0, errors.New("redis: connection refused")
+}
+
+func TestQuotas(t *testing.T) {
+	q, err := ParseQuotas([]byte(`
+default: {limit: 100, period: 1s}
+users:
+  partner-a: {limit: 1000, period: 1s, burst: 2000}
+operations:
+  Export: {limit: 10, period: 1m}
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		caller Caller
+		want   Quota
+	}{
+		{Caller{User: "partner-a", Operation: "Export"}, Quota{Limit: 1000, Period: time.Second, Burst: 2000}},
+		{Caller{User: "partner-b", Operation: "Export"}, PerMinute(10)},
+		{Caller{User: "partner-b", Operation: "Query"}, PerSecond(100)},
+	}
+	for _, tt := range tests {
+		if got := q.Quota(tt.caller); got != tt.want {
+			t.Errorf("Quota(%+v) = %+v, want %+v", tt.caller, got, tt.want)
+		}
+	}
+
+	c := Caller{User: "partner-a", Operation: "Query", Addr: "10.0.0.1:5000"}
+	for f, want := range map[string]string{
+		ByUser(c):                          "user:partner-a",
+		ByUser(Caller{Addr: "10.0.0.1:1"}): "ip:10.0.0.1",
+		ByIP(c):                            "ip:10.0.0.1",
+		ByOperation(c):                     "op:Query",
+		ByUserOperation(c):                 "user:partner-a|Query",
+	} {
+		if f != want {
+			t.Errorf("key = %s, want %s", f, want)
+		}
+	}
+}
+
+func TestRateLimiterOperations(t *testing.T) {
+	ctx := context.Background()
+	// the example of the Quotas doc
+	q, err := ParseQuotas([]byte(`
+default: {limit: 100, period: 1s}
+users:
+  partner-a: {limit: 1000, period: 1s, burst: 2000}
+operations:
+  /api.order.v1.Order/Export: {limit: 10, period: 1m}
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	l := NewRateLimiter(q)
+	now := time.Unix(1660000000, 0)
+	l.now = func() time.Time { return now }
+
+	export := Caller{User: "partner-b", Operation: "/api.order.v1.Order/Export"}
+	query := Caller{User: "partner-b", Operation: "/api.order.v1.Order/Query"}
+	for i := 0; i < 10; i++ {
+		if err := l.Allow(ctx, export); err != nil {
+			t.Fatalf("Allow() export %d = %v", i, err)
+		}
+	}
+	err = l.Allow(ctx, export)
+	if !errorutil.ErrTooManyRequests.Is(err) {
+		t.Fatalf("Allow() export over 10/m = %v", err)
+	}
+	if got := errorutil.FromError(err).Metadata[MetadataRetryAfter]; got != "6" {
+		t.Errorf("retry after = %s, want the 10/m refill", got)
+	}
+	// the default quota of the other operations is not drained by the exports
+	for i := 0; i < 100; i++ {
+		if err := l.Allow(ctx, query); err != nil {
+			t.Fatalf("Allow() query %d = %v", i, err)
+		}
+	}
+	if err := l.Allow(ctx, query); !errorutil.ErrTooManyRequests.Is(err) {
+		t.Errorf("Allow() query over 100/s = %v", err)
+	}
+	if err := l.Allow(ctx, export); !errorutil.ErrTooManyRequests.Is(err) {
+		t.Errorf("Allow() export refilled at the default rate = %v", err)
+	}
+	// the quota of partner-a applies to all its operations
+	for i := 0; i < 2000; i++ {
+		if err := l.Allow(ctx, Caller{User: "partner-a", Operation: "/api.order.v1.Order/Export"}); err != nil {
+			t.Fatalf("Allow() partner-a %d = %v", i, err)
+		}
+	}
+}
+
+func TestRateLimiter(t *testing.T) {
+	ctx := context.Background()
+	l := NewRateLimiter(&Quotas{Users: map[string]Quota{"partner-a": PerSecond(1)}}, WithLogger(log.DefaultLogger))
+	now := time.Unix(1660000000, 0)
+	l.now = func() time.Time { return now }
+
+	if err := l.Allow(ctx, Caller{User: "partner-a"}); err != nil {
+		t.Fatalf("Allow() = %v", err)
+	}
+	err := l.Allow(ctx, Caller{User: "partner-a"})
+	if !errorutil.ErrTooManyRequests.Is(err) {
+		t.Fatalf("Allow() over quota = %v", err)
+	}
+	if got := errorutil.FromError(err).Metadata[MetadataRetryAfter]; got != "1" {
+		t.Errorf("retry after = %s, want 1", got)
+	}
+	if errorutil.HTTPStatus(err) != 429 {
+		t.Errorf("HTTPStatus() = %d, want 429", errorutil.HTTPStatus(err))
+	}
+	for i := 0; i < 3; i++ {
+		if err := l.Allow(ctx, Caller{User: "partner-b"}); err != nil {
+			t.Errorf("Allow() without quota = %v", err)
+		}
+	}
+
+	l = NewRateLimiter(&Quotas{Default: PerSecond(1)}, WithBackend(failingBackend{}), WithLogger(log.DefaultLogger))
+	if err := l.Allow(ctx, Caller{User: "partner-a"}); err != nil {
+		t.Errorf("Allow() with failing backend = %v, want fail open", err)
+	}
+}
@@ -5,13 +5,12 @@ import (
 	"context"
 	"crypto/md5"
 	"encoding/hex"
-	"errors"
 	"fmt"
+	authutil "github.com/XuThreeFire/goutil/authx"
 	errorutil "github.com/XuThreeFire/goutil/errorx"
 	"github.com/go-kit/kit/endpoint"
 	kithttp "github.com/go-kit/kit/transport/http"
 	"io/ioutil"
-	"math"
 	"net/http"
 	"strconv"
 	"time"
@@ -46,7 +45,10 @@ func (a AuthError) Error() string {
 }
 
 // AuthMiddleware returns Authentication middleware for a private sign
-func AuthMiddleware(authUserMap map[string]bool, signKey string) endpoint.Middleware {
+// 使用 CalculateSignatureToContext 放入 context 的签名请求, 由 authutil.Options.Verify 校验:
+// 签名通过后校验时间戳(默认 ±120s, WithSkew 配置)及 Nonce 防重放, WithTestMode 时允许测试签名
+func AuthMiddleware(authUserMap map[string]bool, signKey string, opts ...authutil.Option) endpoint.Middleware {
+	o := authutil.NewOptions(opts...)
 	return func(next endpoint.Endpoint) endpoint.Endpoint {
 		return func(ctx context.Context, request interface{}) (interface{}, error) {
 
@@ -58,60 +60,55 @@ func AuthMiddleware(authUserMap map[string]bool, signKey string) endpoint.Middle
 			if authUserMap[reqAuthUser] == false {
 				return nil, errorutil.ErrIllegaUser
 			}
-			// signature
-			signature, ok := ctx.Value(ContextKeyRequestSignature).(string)
+			// signature, timestamp, nonce
+			sr, ok := authutil.RequestFromContext(ctx)
 			if !ok {
 				return nil, errorutil.ErrSignatureError
 			}
-			calculateSignature, ok := ctx.Value(ContextKeyCalculateSignature).(string)
-			if !ok {
-				return nil, errorutil.ErrSignatureError
-			}
-			if signature != calculateSignature {
-				return nil, errorutil.ErrSignatureError
-			}
-
-			// timestamp
-			timestampStr, ok := ctx.Value(ContextKeyRequestTimestamp).(string)
-			if !ok {
-				return nil, errorutil.ErrExpiredSignature
-			}
-			timestamp, err := strconv.ParseInt(timestampStr, 10, 64)
-			if err != nil {
-				return nil, errorutil.ErrExpiredSignature
-			}
-			diff := time.Now().UnixMilli() - timestamp
-
-			// TODO: 时间差配置
-			if math.Abs(float64(diff)) > 120*1000 {
-				return nil, errors.New(fmt.Sprintf("diff=%v, err=%s", diff, errorutil.ErrExpiredSignature.Error()))
+			if err := o.Verify(ctx, sr, signKey); err != nil {
+				return nil, err
 			}
 			return next(ctx, request)
 		}
 	}
 }
 
-// CalculateSignatureToContext returns an kithttp.HandlerFunc that context wraps the sign parameters.
-func CalculateSignatureToContext(myUser, signKey string) kithttp.RequestFunc {
+// CalculateSignatureToContext returns an kithttp.HandlerFunc that context wraps the sign parameters
+// and the signed request verified by AuthMiddleware, pass the authutil options to AuthMiddleware.
+// The body is read by authutil.Options.ReadBody, rewound for the decoder, at most WithMaxBodySize,
+// or spooled to a temporary file up to WithMaxHashedBodySize in the hash-of-body mode.
+// ContextKeyCalculateSignature is kept for compatibility, calculated with the negotiated algorithm
+// and the options here.
+func CalculateSignatureToContext(myUser, signKey string, opts ...authutil.Option) kithttp.RequestFunc {
+	o := authutil.NewOptions(opts...)
 	return func(ctx context.Context, r *http.Request) context.Context {
-		var bodyBytes []byte
+		sr := authutil.RequestFromHeader(r.Header.Get)
+		sr.Addr = r.RemoteAddr
 		if r.Method != "GET" {
-			bodyBytes, _ = ioutil.ReadAll(r.Body)
-			r.Body.Close()
-			r.Body = ioutil.NopCloser(bytes.NewBuffer(bodyBytes))
+			// a body over WithMaxBodySize leaves the request unset so AuthMiddleware rejects it
+			if err := o.ReadBody(r, sr); err == nil {
+				ctx = authutil.NewRequestContext(ctx, sr)
+			}
+		} else {
+			ctx = authutil.NewRequestContext(ctx, sr)
 		}
 
-		authUser := r.Header.Get(string(ContextKeyRequestAuthUser))
-		method := r.Header.Get(string(ContextKeyRequestMethod))
-		timestamp := r.Header.Get(string(ContextKeyRequestTimestamp))
-		signature := r.Header.Get(string(ContextKeyRequestSignature))
-		//calculateSignature := CalculateSignature(myUser, method, timestamp, bodyBytes, signKey)
-		calculateSignature := CalculateSignature(authUser, method, timestamp, bodyBytes, signKey)
+		ctx = context.WithValue(ctx, ContextKeyRequestTimestamp, sr.Timestamp)
+		ctx = context.WithValue(ctx, ContextKeyRequestNonce, sr.Nonce)
+		ctx = context.WithValue(ctx, ContextKeyRequestMethod, sr.Method)
+		ctx = context.WithValue(ctx, ContextKeyRequestAuthUser, sr.User)
+		ctx = context.WithValue(ctx, ContextKeyRequestSignature, sr.Signature)
+		ctx = context.WithValue(ctx, ContextKeyRequestRemoteAddr, sr.Addr)
 
-		ctx = context.WithValue(ctx, ContextKeyRequestTimestamp, timestamp)
-		ctx = context.WithValue(ctx, ContextKeyRequestMethod, method)
-		ctx = context.WithValue(ctx, ContextKeyRequestAuthUser, authUser)
-		ctx = context.WithValue(ctx, ContextKeyRequestSignature, signature)
+		signer, err := o.Signer(sr.Alg)
+		if err != nil {
+			return ctx
+		}
+		//calculateSignature := CalculateSignature(myUser, method, timestamp, bodyBytes, signKey)
+		calculateSignature, err := o.Signature(ctx, signer, sr.User, signKey, sr.Signature, sr.Data())
+		if err != nil {
+			return ctx
+		}
 		ctx = context.WithValue(ctx, ContextKeyCalculateSignature, calculateSignature)
 
 		return ctx
@@ -121,13 +118,15 @@ func CalculateSignatureToContext(myUser, signKey string) kithttp.RequestFunc {
 // CalculateSignature 计算签名
 // md5sum(AuthUser+Method+Timestamp+{request body}+signKey)) 小写
 func CalculateSignature(authUser, method, timestamp string, bodyBytes []byte, signKey string) string {
-	h := md5.New()
-	h.Write([]byte(authUser + method + timestamp + string(bodyBytes) + signKey))
-	return hex.EncodeToString(h.Sum(nil))
+	signer, _ := authutil.GetSigner(authutil.AlgMD5)
+	return signer.Sign(authutil.SignData(authUser, method, timestamp, "", bodyBytes), signKey)
 }
 
 // GenerateSignatureToRequest 生成签名headers字段
-func GenerateSignatureToRequest(authUser, signKey, method string) kithttp.RequestFunc {
+// 非md5算法时同时设置 Sign-Alg, WithNonce 时设置 Nonce, WithKeyProvider 时使用该用户的主密钥
+func GenerateSignatureToRequest(authUser, signKey, method string, opts ...authutil.Option) kithttp.RequestFunc {
+	o := authutil.NewOptions(opts...)
+	o.ClientSigner() // panic on an unsupported algorithm when building the client
 	return func(ctx context.Context, r *http.Request) context.Context {
 		var bodyBytes []byte
 		if r.Method != "GET" {
@@ -138,12 +137,15 @@ func GenerateSignatureToRequest(authUser, signKey, method string) kithttp.Reques
 			bodyBytes = nil
 		}
 
-		timestamp := strconv.FormatInt(time.Now().UnixMilli(), 10)
-		calculateSignature := CalculateSignature(authUser, method, timestamp, bodyBytes, signKey)
-		r.Header.Set(string(ContextKeyRequestAuthUser), authUser)
-		r.Header.Set(string(ContextKeyRequestMethod), method)
-		r.Header.Set(string(ContextKeyRequestTimestamp), timestamp)
-		r.Header.Set(string(ContextKeyRequestSignature), calculateSignature)
+		sr := &authutil.Request{
+			User:   authUser,
+			Method: method,
+			Body:   bodyBytes,
+		}
+		if err := o.Sign(ctx, sr, signKey); err != nil {
+			return ctx
+		}
+		sr.SetHeader(r.Header.Set)
 		return ctx
 	}
 }
@@ -224,11 +226,11 @@ func GenerateSignatureToRequestForTcServer(authPartnerId, authInterfaceKey, meth
 	}
 }
 
-// CalculateSignature 计算签名
-// md5sum(AuthUser+Method+Timestamp+{request body}+signKey)) 小写
+// CalculateSignatureForTcServer 计算签名
+// md5sum(PartnerId+Method+Timestamp+md5sum(InterfaceKey)) 小写
 func CalculateSignatureForTcServer(authPartnerId, authInterfaceKey, method, reqTimestamp string) string {
 	h := md5.New()
-	h.Write([]byte(fmt.Sprintf("%s%s%s", authPartnerId, method, reqTimestamp, md5.Sum([]byte(authInterfaceKey)))))
+	h.Write([]byte(fmt.Sprintf("%s%s%s%x", authPartnerId, method, reqTimestamp, md5.Sum([]byte(authInterfaceKey)))))
 	return hex.EncodeToString(h.Sum(nil))
 }
 
@@ -0,0 +1,27 @@
+package midutil
+
+import (
+	"context"
+
+	authutil "github.com/XuThreeFire/goutil/authx"
+	"github.com/go-kit/kit/endpoint"
+)
+
+// AuthorizeMiddleware returns Authorization middleware for the method of the endpoint
+// 在 AuthMiddleware 或 JWTMiddleware 之后按策略校验用户能否调用 method,
+// method 必须是路由对应的方法, 不能取自调用方可控的 Method 头, 为空时 panic,
+// 拒绝时返回 errorx.ErrIllegalRequest (dry-run 模式只记录日志)
+func AuthorizeMiddleware(a *authutil.Authorizer, method string) endpoint.Middleware {
+	if method == "" {
+		panic("midutil: AuthorizeMiddleware requires the method of the endpoint")
+	}
+	return func(next endpoint.Endpoint) endpoint.Endpoint {
+		return func(ctx context.Context, request interface{}) (interface{}, error) {
+			user, roles := authutil.SubjectFromContext(ctx)
+			if err := a.Authorize(ctx, user, roles, method); err != nil {
+				return nil, err
+			}
+			return next(ctx, request)
+		}
+	}
+}
@@ -0,0 +1,45 @@
+package midutil
+
+import (
+	"context"
+	"testing"
+
+	authutil "github.com/XuThreeFire/goutil/authx"
+	errorutil "github.com/XuThreeFire/goutil/errorx"
+)
+
+func TestAuthorizeMiddleware(t *testing.T) {
+	p, err := authutil.ParsePolicy([]byte(`
+users:
+  partner-a:
+    allow: [Query]
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	a := authutil.NewAuthorizer(p)
+	ctx := context.WithValue(context.Background(), ContextKeyUserName, "partner-a")
+	// the caller claims an allowed method in its signed Method header
+	ctx = context.WithValue(ctx, ContextKeyRequestMethod, "Query")
+
+	tests := []struct {
+		method  string
+		allowed bool
+	}{
+		{"Query", true},
+		{"Delete", false},
+	}
+	for _, tt := range tests {
+		_, err := AuthorizeMiddleware(a, tt.method)(echoUser)(ctx, nil)
+		if tt.allowed && err != nil || !tt.allowed && !errorutil.ErrIllegalRequest.Is(err) {
+			t.Errorf("AuthorizeMiddleware(%s) = %v, want allowed %v", tt.method, err, tt.allowed)
+		}
+	}
+
+	defer func() {
+		if recover() == nil {
+			t.Error("AuthorizeMiddleware() without method must panic")
+		}
+	}()
+	AuthorizeMiddleware(a, "")
+}
@@ -1,6 +1,9 @@
 package midutil
 
-type contextKey string
+import authutil "github.com/XuThreeFire/goutil/authx"
+
+// contextKey is shared with the kratos middlewares, so a key set by either is visible to both.
+type contextKey = authutil.ContextKey
 
 const (
 	// ContextKeyRequestTraceID Trace-Id `uuid` 无`-` 分割格式，模块交互可一直传递使用
@@ -21,6 +24,12 @@ const (
 	// ContextKeyRequestSignature Signature 签名
 	ContextKeyRequestSignature contextKey = "Signature"
 
+	// ContextKeyRequestNonce Nonce 随机数，参与签名，防重放
+	ContextKeyRequestNonce contextKey = "Nonce"
+
+	// ContextKeyRequestRemoteAddr RemoteAddr 请求来源地址，测试模式校验来源网段
+	ContextKeyRequestRemoteAddr contextKey = "RemoteAddr"
+
 	// ContextKeyCalculateSignature CalculateSignature 计算签名
 	ContextKeyCalculateSignature contextKey = "CalculateSignature"
 
@@ -28,8 +37,14 @@ const (
 	ContextKeyInterfaceKey contextKey = "InterfaceKey"
 
 	// ContextKeyInterfaceKey PartnerId 授权的partnerId
-	ContextKeyPartnerId contextKey = "PartnerId"
-	ContextKeyUserName  contextKey = "UserName"
+	ContextKeyPartnerId contextKey = authutil.ContextKeyPartnerId
+	ContextKeyUserName  contextKey = authutil.ContextKeyUserName
 	ContextKeyUserKey   contextKey = "UserKey"
 	ContextKeyTraceId   contextKey = "TraceId"
+
+	// ContextKeyBearerToken BearerToken Authorization 头的 bearer token
+	ContextKeyBearerToken contextKey = "BearerToken"
+
+	// ContextKeyRequestTimeout X-Request-Timeout 调用方剩余时间(毫秒)
+	ContextKeyRequestTimeout contextKey = "X-Request-Timeout"
 )
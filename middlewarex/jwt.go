@@ -0,0 +1,72 @@
+package midutil
+
+import (
+	"context"
+	"net/http"
+
+	authutil "github.com/XuThreeFire/goutil/authx"
+	errorutil "github.com/XuThreeFire/goutil/errorx"
+	"github.com/go-kit/kit/endpoint"
+	kithttp "github.com/go-kit/kit/transport/http"
+)
+
+// BearerToContext returns an kithttp.RequestFunc that context wraps the bearer token
+// of the Authorization header, verified by JWTMiddleware.
+func BearerToContext() kithttp.RequestFunc {
+	return func(ctx context.Context, r *http.Request) context.Context {
+		if token, ok := authutil.BearerToken(r.Header.Get(authutil.HeaderAuthorization)); ok {
+			ctx = context.WithValue(ctx, ContextKeyBearerToken, token)
+		}
+		return ctx
+	}
+}
+
+// JWTMiddleware returns Authentication middleware for a bearer token
+// 校验 BearerToContext 放入 context 的 token, claims 映射到 ContextKeyUserName 及 ContextKeyPartnerId
+func JWTMiddleware(v *authutil.JWTVerifier) endpoint.Middleware {
+	return func(next endpoint.Endpoint) endpoint.Endpoint {
+		return func(ctx context.Context, request interface{}) (interface{}, error) {
+			token, ok := ctx.Value(ContextKeyBearerToken).(string)
+			if !ok {
+				return nil, errorutil.ErrSignatureError.WithMessage("missing bearer token")
+			}
+			claims, err := v.Verify(ctx, token)
+			if err != nil {
+				return nil, err
+			}
+			return next(v.NewContext(ctx, claims), request)
+		}
+	}
+}
+
+// AnyOf is the "any of" policy of the authentication middlewares, e.g. AuthMiddleware and JWTMiddleware:
+// a request is accepted by the first middleware which accepts it, in order, and rejected with
+// the error of the first one if none does. The middlewares must only act before the endpoint.
+// It panics without middlewares, which would accept every request.
+func AnyOf(ms ...endpoint.Middleware) endpoint.Middleware {
+	if len(ms) == 0 {
+		panic("midutil: AnyOf requires at least one middleware")
+	}
+	return func(next endpoint.Endpoint) endpoint.Endpoint {
+		return func(ctx context.Context, request interface{}) (interface{}, error) {
+			var firstErr error
+			for i, m := range ms {
+				var (
+					accepted bool
+					authCtx  context.Context
+				)
+				_, err := m(func(ctx context.Context, request interface{}) (interface{}, error) {
+					accepted, authCtx = true, ctx
+					return nil, nil
+				})(ctx, request)
+				if accepted {
+					return next(authCtx, request)
+				}
+				if i == 0 {
+					firstErr = err
+				}
+			}
+			return nil, firstErr
+		}
+	}
+}
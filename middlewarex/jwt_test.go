@@ -0,0 +1,119 @@
+package midutil
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	authutil "github.com/XuThreeFire/goutil/authx"
+	errorutil "github.com/XuThreeFire/goutil/errorx"
+)
+
+var secret = []byte("secret")
+
+// hs256 signs an HS256 token of the claims.
+func hs256(claims string) string {
+	header := base64.RawURLEncoding.EncodeToString([]byte(`{"alg":"HS256"}`))
+	payload := base64.RawURLEncoding.EncodeToString([]byte(claims))
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte(header + "." + payload))
+	return header + "." + payload + "." + base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// echoUser returns the user name in the context.
+func echoUser(ctx context.Context, request interface{}) (interface{}, error) {
+	user, _ := ctx.Value(ContextKeyUserName).(string)
+	return user, nil
+}
+
+func TestJWTMiddleware(t *testing.T) {
+	e := JWTMiddleware(authutil.NewJWTVerifier(authutil.StaticKey(secret)))(echoUser)
+	tests := []struct {
+		name          string
+		authorization string
+		want          string
+	}{
+		{"bearer", "Bearer " + hs256(`{"sub":"alice","exp":4102444800}`), "alice"},
+		{"bad signature", "Bearer " + hs256(`{"sub":"alice","exp":4102444800}`) + "x", ""},
+		{"missing", "", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, "/", nil)
+			r.Header.Set(authutil.HeaderAuthorization, tt.authorization)
+			user, err := e(BearerToContext()(context.Background(), r), nil)
+			if tt.want == "" {
+				if !errorutil.ErrSignatureError.Is(err) {
+					t.Errorf("endpoint() = %v, want ErrSignatureError", err)
+				}
+				return
+			}
+			if err != nil || user != tt.want {
+				t.Errorf("endpoint() = %v, %v, want %s", user, err, tt.want)
+			}
+		})
+	}
+}
+
+func TestAnyOf(t *testing.T) {
+	e := AnyOf(
+		JWTMiddleware(authutil.NewJWTVerifier(authutil.StaticKey(secret))),
+		AuthMiddleware(map[string]bool{"user": true}, "key"),
+	)(func(ctx context.Context, request interface{}) (interface{}, error) {
+		if user, ok := ctx.Value(ContextKeyUserName).(string); ok {
+			return user, nil
+		}
+		return ctx.Value(ContextKeyRequestAuthUser), nil
+	})
+	// signed signs the request as user
+	signed := func(r *http.Request) {
+		sr := &authutil.Request{User: "user", Method: "Query", Body: []byte(`{"id":1}`)}
+		if err := authutil.NewOptions().Sign(context.Background(), sr, "key"); err != nil {
+			t.Fatal(err)
+		}
+		sr.SetHeader(r.Header.Set)
+	}
+	tests := []struct {
+		name    string
+		request func(r *http.Request)
+		want    interface{}
+		wantErr *errorutil.Error
+	}{
+		{"bearer", func(r *http.Request) {
+			r.Header.Set(authutil.HeaderAuthorization, "Bearer "+hs256(`{"sub":"alice","exp":4102444800}`))
+		}, "alice", nil},
+		{"signature", signed, "user", nil},
+		// rejected with the error of the first middleware
+		{"none", func(r *http.Request) {}, nil, errorutil.ErrSignatureError},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(`{"id":1}`))
+			tt.request(r)
+			ctx := BearerToContext()(context.Background(), r)
+			ctx = CalculateSignatureToContext("user", "key")(ctx, r)
+			got, err := e(ctx, nil)
+			if tt.wantErr != nil {
+				if !tt.wantErr.Is(err) {
+					t.Errorf("endpoint() = %v, want %v", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil || got != tt.want {
+				t.Errorf("endpoint() = %v, %v, want %v", got, err, tt.want)
+			}
+		})
+	}
+
+	defer func() {
+		if recover() == nil {
+			t.Error("AnyOf() without middlewares must panic")
+		}
+	}()
+	AnyOf()
+}
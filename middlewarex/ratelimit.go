@@ -0,0 +1,43 @@
+package midutil
+
+import (
+	"context"
+	"net/http"
+
+	authutil "github.com/XuThreeFire/goutil/authx"
+	limitutil "github.com/XuThreeFire/goutil/limitx"
+	"github.com/go-kit/kit/endpoint"
+	kithttp "github.com/go-kit/kit/transport/http"
+)
+
+// RemoteAddrToContext returns an kithttp.RequestFunc that context wraps the client address,
+// for RateLimitMiddleware keyed by IP without CalculateSignatureToContext.
+func RemoteAddrToContext() kithttp.RequestFunc {
+	return func(ctx context.Context, r *http.Request) context.Context {
+		return context.WithValue(ctx, ContextKeyRequestRemoteAddr, r.RemoteAddr)
+	}
+}
+
+// RateLimitMiddleware returns Rate limiting middleware for the method of the endpoint
+// 在认证中间件之后按 Auth-User(或 bearer token 用户)、method 或来源 IP 限流,
+// method 必须是路由对应的方法, 不能取自调用方可控的 Method 头, 为空时 panic,
+// 超限返回 errorx.ErrTooManyRequests, Metadata 的 retry_after 为建议重试的秒数
+func RateLimitMiddleware(l *limitutil.RateLimiter, method string) endpoint.Middleware {
+	if method == "" {
+		panic("midutil: RateLimitMiddleware requires the method of the endpoint")
+	}
+	return func(next endpoint.Endpoint) endpoint.Endpoint {
+		return func(ctx context.Context, request interface{}) (interface{}, error) {
+			if err := l.Allow(ctx, callerFromContext(ctx, method)); err != nil {
+				return nil, err
+			}
+			return next(ctx, request)
+		}
+	}
+}
+
+func callerFromContext(ctx context.Context, method string) limitutil.Caller {
+	user, _ := authutil.SubjectFromContext(ctx)
+	addr, _ := ctx.Value(ContextKeyRequestRemoteAddr).(string)
+	return limitutil.Caller{User: user, Operation: method, Addr: addr}
+}
@@ -0,0 +1,48 @@
+package midutil
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	errorutil "github.com/XuThreeFire/goutil/errorx"
+	limitutil "github.com/XuThreeFire/goutil/limitx"
+)
+
+func TestRateLimitMiddleware(t *testing.T) {
+	l := limitutil.NewRateLimiter(&limitutil.Quotas{
+		Default:    limitutil.PerSecond(100),
+		Operations: map[string]limitutil.Quota{"Export": limitutil.PerMinute(1)},
+	})
+	export := RateLimitMiddleware(l, "Export")(echoUser)
+	ctx := context.WithValue(context.Background(), ContextKeyUserName, "partner-a")
+	// the caller claims an unlimited method in its signed Method header
+	ctx = context.WithValue(ctx, ContextKeyRequestMethod, "Query")
+
+	if _, err := export(ctx, nil); err != nil {
+		t.Fatalf("endpoint() = %v", err)
+	}
+	_, err := export(ctx, nil)
+	if !errorutil.ErrTooManyRequests.Is(err) {
+		t.Fatalf("endpoint() over quota = %v", err)
+	}
+	if got := errorutil.FromError(err).Metadata[limitutil.MetadataRetryAfter]; got != "60" {
+		t.Errorf("retry after = %s, want 60", got)
+	}
+
+	// the callers without user are keyed by IP
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	r.RemoteAddr = "10.0.0.1:5000"
+	anonymous := RemoteAddrToContext()(context.Background(), r)
+	if _, err := export(anonymous, nil); err != nil {
+		t.Errorf("endpoint() from another IP = %v", err)
+	}
+
+	defer func() {
+		if recover() == nil {
+			t.Error("RateLimitMiddleware() without method must panic")
+		}
+	}()
+	RateLimitMiddleware(l, "")
+}
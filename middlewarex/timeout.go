@@ -0,0 +1,61 @@
+package midutil
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"time"
+
+	errorutil "github.com/XuThreeFire/goutil/errorx"
+	timeutil "github.com/XuThreeFire/goutil/timex"
+	"github.com/go-kit/kit/endpoint"
+	kithttp "github.com/go-kit/kit/transport/http"
+)
+
+// TimeoutToContext returns an kithttp.RequestFunc that context wraps the remaining time of the caller
+// in the X-Request-Timeout header, applied by TimeoutMiddleware.
+func TimeoutToContext() kithttp.RequestFunc {
+	return func(ctx context.Context, r *http.Request) context.Context {
+		if v := r.Header.Get(timeutil.HeaderRequestTimeout); v != "" {
+			ctx = context.WithValue(ctx, ContextKeyRequestTimeout, v)
+		}
+		return ctx
+	}
+}
+
+// TimeoutMiddleware returns Timeout middleware for the method of the endpoint
+// 按 timeouts 配置的 method 超时时间执行, 调用方剩余时间(TimeoutToContext)更短时以其为准,
+// 超时返回 errorx.ErrDeadlineExceeded, method 必须是路由对应的方法, 不能取自调用方可控的 Method 头, 为空时 panic
+func TimeoutMiddleware(timeouts *timeutil.Timeouts, method string) endpoint.Middleware {
+	if method == "" {
+		panic("midutil: TimeoutMiddleware requires the method of the endpoint")
+	}
+	return func(next endpoint.Endpoint) endpoint.Endpoint {
+		return func(ctx context.Context, request interface{}) (interface{}, error) {
+			header, _ := ctx.Value(ContextKeyRequestTimeout).(string)
+			ctx, cancel := timeutil.WithTimeout(ctx, timeouts, method, header)
+			defer cancel()
+			response, err := next(ctx, request)
+			if err != nil && errors.Is(ctx.Err(), context.DeadlineExceeded) {
+				if se := new(errorutil.Error); !errors.As(err, &se) {
+					err = errorutil.ErrDeadlineExceeded.WithCause(err)
+				}
+			}
+			return response, err
+		}
+	}
+}
+
+// TimeoutToRequest returns an kithttp.RequestFunc that sets the remaining time of the context
+// in the X-Request-Timeout header, so the upstream does not work past it.
+// Nothing is set once the deadline passed, the request then fails with the context.
+func TimeoutToRequest() kithttp.RequestFunc {
+	return func(ctx context.Context, r *http.Request) context.Context {
+		if deadline, ok := ctx.Deadline(); ok {
+			if remaining := time.Until(deadline); remaining > 0 {
+				r.Header.Set(timeutil.HeaderRequestTimeout, timeutil.FormatTimeout(remaining))
+			}
+		}
+		return ctx
+	}
+}
@@ -0,0 +1,74 @@
+package midutil
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	errorutil "github.com/XuThreeFire/goutil/errorx"
+	timeutil "github.com/XuThreeFire/goutil/timex"
+)
+
+func TestTimeoutMiddleware(t *testing.T) {
+	timeouts := &timeutil.Timeouts{Operations: map[string]time.Duration{"Export": 50 * time.Millisecond}}
+	// slow waits for the deadline of the request
+	slow := func(ctx context.Context, request interface{}) (interface{}, error) {
+		<-ctx.Done()
+		return nil, ctx.Err()
+	}
+	export := TimeoutMiddleware(timeouts, "Export")(slow)
+	// the caller claims a method without timeout in its signed Method header
+	ctx := context.WithValue(context.Background(), ContextKeyRequestMethod, "Query")
+
+	start := time.Now()
+	if _, err := export(ctx, nil); !errorutil.ErrDeadlineExceeded.Is(err) {
+		t.Errorf("endpoint() = %v, want errorx deadline exceeded", err)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("endpoint() took %v, want the method timeout", elapsed)
+	}
+
+	// the shorter remaining time of the caller wins
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	r.Header.Set(timeutil.HeaderRequestTimeout, "10")
+	var remaining time.Duration
+	deadline := func(ctx context.Context, request interface{}) (interface{}, error) {
+		d, _ := ctx.Deadline()
+		remaining = time.Until(d)
+		return nil, nil
+	}
+	if _, err := TimeoutMiddleware(timeouts, "Export")(deadline)(TimeoutToContext()(ctx, r), nil); err != nil {
+		t.Fatalf("endpoint() = %v", err)
+	}
+	if remaining > 10*time.Millisecond {
+		t.Errorf("remaining = %v, want the caller timeout", remaining)
+	}
+
+	defer func() {
+		if recover() == nil {
+			t.Error("TimeoutMiddleware() without method must panic")
+		}
+	}()
+	TimeoutMiddleware(timeouts, "")
+}
+
+func TestTimeoutToRequest(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	TimeoutToRequest()(ctx, r)
+	if ms, _ := strconv.Atoi(r.Header.Get(timeutil.HeaderRequestTimeout)); ms <= 900 || ms > 1000 {
+		t.Errorf("%s = %d, want the remaining time", timeutil.HeaderRequestTimeout, ms)
+	}
+
+	expired, cancel := context.WithDeadline(context.Background(), time.Now().Add(-time.Second))
+	defer cancel()
+	r = httptest.NewRequest(http.MethodGet, "/", nil)
+	TimeoutToRequest()(expired, r)
+	if v := r.Header.Get(timeutil.HeaderRequestTimeout); v != "" {
+		t.Errorf("%s = %s after the deadline, want none", timeutil.HeaderRequestTimeout, v)
+	}
+}
@@ -2,9 +2,11 @@ package midutil
 
 import (
 	"context"
+	authutil "github.com/XuThreeFire/goutil/authx"
+	errorutil "github.com/XuThreeFire/goutil/errorx"
+	"github.com/XuThreeFire/goutil/kratosx/klog"
 	kithttp "github.com/go-kit/kit/transport/http"
 	"github.com/go-kratos/kratos/v2/log"
-	"github.com/go-kratos/kratos/v2/transport"
 	"github.com/google/uuid"
 	"net/http"
 	"strings"
@@ -16,14 +18,21 @@ func GenerateTraceID() string {
 	return strings.ReplaceAll(traceID, "-", "")
 }
 
-// TraceIDFormContext get trace id form context
+// TraceIDFormContext get trace id form context, set by the go-kit or the kratos middlewares
 func TraceIDFormContext(ctx context.Context) string {
-	val := ctx.Value(ContextKeyRequestTraceID)
-	if traceID, ok := val.(string); ok {
+	if traceID, ok := traceIDFromContext(ctx); ok {
 		return traceID
 	}
 	return GenerateTraceID()
 }
+
+func traceIDFromContext(ctx context.Context) (string, bool) {
+	if traceID, ok := authutil.TraceIDFromContext(ctx); ok {
+		return traceID, true
+	}
+	traceID, ok := ctx.Value(ContextKeyRequestTraceID).(string)
+	return traceID, ok
+}
 func RequestIDFormContext(ctx context.Context) string {
 	val := ctx.Value(ContextKeyRequestTraceID)
 	if requestID, ok := val.(string); ok {
@@ -32,8 +41,9 @@ func RequestIDFormContext(ctx context.Context) string {
 	return ""
 }
 
-// ContextWithTraceID context wraps the trace id
+// ContextWithTraceID context wraps the trace id, visible to the kratos middlewares as well
 func ContextWithTraceID(ctx context.Context, traceID string) context.Context {
+	ctx = authutil.NewTraceContext(ctx, traceID)
 	return context.WithValue(ctx, ContextKeyRequestTraceID, traceID)
 }
 
@@ -43,7 +53,7 @@ func ContextWithRequestID(ctx context.Context, requestID string) context.Context
 }
 
 // HTTPToContext returns an http.HandlerFunc that context wraps the traceId
-// 从请求里面提取traceId、requestId
+// 从请求里面提取traceId、requestId、Accept-Language
 func HTTPToContext() kithttp.RequestFunc {
 	return func(ctx context.Context, req *http.Request) context.Context {
 		// trace-id
@@ -51,7 +61,7 @@ func HTTPToContext() kithttp.RequestFunc {
 		if traceID == "" {
 			traceID = GenerateTraceID()
 		}
-		ctx = context.WithValue(ctx, ContextKeyRequestTraceID, traceID)
+		ctx = ContextWithTraceID(ctx, traceID)
 
 		// x-request-id
 		requestID := req.Header.Get(string(ContextKeyRequestXRequestID))
@@ -59,6 +69,11 @@ func HTTPToContext() kithttp.RequestFunc {
 			requestID = uuid.New().String()
 		}
 		ctx = context.WithValue(ctx, ContextKeyRequestXRequestID, requestID)
+
+		// accept-language, errorx reasons are rendered in this language
+		if locales := errorutil.ParseAcceptLanguage(req.Header.Get("Accept-Language")); len(locales) > 0 {
+			ctx = errorutil.NewLocaleContext(ctx, locales...)
+		}
 		return ctx
 	}
 }
@@ -68,15 +83,9 @@ func HTTPToContext() kithttp.RequestFunc {
 func ContextToHTTPRequest() kithttp.RequestFunc {
 	return func(ctx context.Context, req *http.Request) context.Context {
 		// Trace-Id
-		val := ctx.Value(ContextKeyRequestTraceID)
-		if traceID, ok := val.(string); ok {
-			req.Header.Set(string(ContextKeyRequestTraceID), traceID)
-		} else {
-			newTraceID := GenerateTraceID()
-			req.Header.Set(string(ContextKeyRequestTraceID), newTraceID)
-		}
+		req.Header.Set(string(ContextKeyRequestTraceID), TraceIDFormContext(ctx))
 		// X-Request-Id, retry 时复用同一个 requestId
-		val = ctx.Value(ContextKeyRequestXRequestID)
+		val := ctx.Value(ContextKeyRequestXRequestID)
 		if requestID, ok := val.(string); ok {
 			req.Header.Set(string(ContextKeyRequestXRequestID), requestID)
 		} else {
@@ -94,12 +103,11 @@ func ContextToHTTPRequest() kithttp.RequestFunc {
 func ContextToHTTPResponse() kithttp.ServerResponseFunc {
 	return func(ctx context.Context, w http.ResponseWriter) context.Context {
 		// Trace-Id
-		val := ctx.Value(ContextKeyRequestTraceID)
-		if traceID, ok := val.(string); ok {
+		if traceID, ok := traceIDFromContext(ctx); ok {
 			w.Header().Set(string(ContextKeyRequestTraceID), traceID)
 		}
 		// X-Request-Id
-		val = ctx.Value(ContextKeyRequestXRequestID)
+		val := ctx.Value(ContextKeyRequestXRequestID)
 		if requestID, ok := val.(string); ok {
 			w.Header().Set(string(ContextKeyRequestXRequestID), requestID)
 		}
@@ -107,22 +115,14 @@ func ContextToHTTPResponse() kithttp.ServerResponseFunc {
 	}
 }
 
-type TraceIDKey struct{}
+// TraceIDKey is the context key of the trace id.
+//
+// Deprecated: use klog.TraceIDKey, it is the same key.
+type TraceIDKey = klog.TraceIDKey
 
 // TraceID returns a trace_id valuer.
+//
+// Deprecated: use klog.TraceID.
 func TraceID() log.Valuer {
-	return func(ctx context.Context) interface{} {
-		if ctx != nil {
-			if info, ok := transport.FromServerContext(ctx); ok {
-				if traceID := info.ReplyHeader().Get("Trace-Id"); traceID != "" {
-					return traceID
-				}
-			}
-			if traceID, ok := ctx.Value(TraceIDKey{}).(string); ok {
-				return traceID
-			}
-		}
-		return ""
-		// return "unknown-" + uuid.New().String()
-	}
+	return klog.TraceID()
 }
@@ -0,0 +1,78 @@
+package timeutil
+
+import (
+	"context"
+	"math"
+	"strconv"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// HeaderRequestTimeout is the header of the remaining time of the caller in milliseconds,
+// a relative timeout rather than an absolute deadline so the clocks need not be in sync.
+const HeaderRequestTimeout = "X-Request-Timeout"
+
+// Timeouts are the server timeouts of the operations, the operations without one use the
+// default, no timeout if zero:
+//
+//	default: 5s
+//	operations:
+//	  /api.order.v1.Order/Export: 30s
+type Timeouts struct {
+	Default    time.Duration            `yaml:"default" json:"default"`
+	Operations map[string]time.Duration `yaml:"operations" json:"operations"`
+}
+
+// ParseTimeouts parses YAML (or JSON) timeouts, durations like "500ms" or "5s".
+func ParseTimeouts(data []byte) (*Timeouts, error) {
+	t := new(Timeouts)
+	if err := yaml.Unmarshal(data, t); err != nil {
+		return nil, err
+	}
+	return t, nil
+}
+
+// Timeout returns the timeout of the operation.
+func (t *Timeouts) Timeout(operation string) time.Duration {
+	if t == nil {
+		return 0
+	}
+	if d, ok := t.Operations[operation]; ok {
+		return d
+	}
+	return t.Default
+}
+
+// FormatTimeout formats the HeaderRequestTimeout value of the remaining time d, at least 1ms.
+func FormatTimeout(d time.Duration) string {
+	ms := d.Milliseconds()
+	if ms < 1 {
+		ms = 1
+	}
+	return strconv.FormatInt(ms, 10)
+}
+
+// ParseTimeout parses a HeaderRequestTimeout value, false if it is empty or invalid,
+// including a value out of the range of time.Duration.
+func ParseTimeout(value string) (time.Duration, bool) {
+	ms, err := strconv.ParseInt(value, 10, 64)
+	if err != nil || ms <= 0 || ms > int64(math.MaxInt64/time.Millisecond) {
+		return 0, false
+	}
+	return time.Duration(ms) * time.Millisecond, true
+}
+
+// WithTimeout returns a copy of ctx with the shorter of the timeout of the operation and the
+// timeout of the caller in the HeaderRequestTimeout value, ctx itself if there is neither.
+// A deadline already in ctx, e.g. from the grpc-timeout header, is kept if it is earlier.
+func WithTimeout(ctx context.Context, timeouts *Timeouts, operation, header string) (context.Context, context.CancelFunc) {
+	d := timeouts.Timeout(operation)
+	if h, ok := ParseTimeout(header); ok && (d <= 0 || h < d) {
+		d = h
+	}
+	if d <= 0 {
+		return ctx, func() {}
+	}
+	return context.WithTimeout(ctx, d)
+}
@@ -0,0 +1,52 @@
+package timeutil
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestWithTimeout(t *testing.T) {
+	timeouts, err := ParseTimeouts([]byte(`
+default: 5s
+operations:
+  Export: 30s
+  Stream: 0s
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		operation, header string
+		want              time.Duration
+	}{
+		{"Query", "", 5 * time.Second},
+		{"Export", "", 30 * time.Second},
+		{"Export", "1000", time.Second},
+		{"Query", "60000", 5 * time.Second},
+		{"Stream", "", 0},
+		{"Stream", "200", 200 * time.Millisecond},
+		{"Query", "bad", 5 * time.Second},
+		{"Query", "9223372036854775807", 5 * time.Second},
+	}
+	for _, tt := range tests {
+		ctx, cancel := WithTimeout(context.Background(), timeouts, tt.operation, tt.header)
+		deadline, ok := ctx.Deadline()
+		cancel()
+		if tt.want == 0 {
+			if ok {
+				t.Errorf("WithTimeout(%s, %q) has a deadline", tt.operation, tt.header)
+			}
+			continue
+		}
+		if got := time.Until(deadline); !ok || got > tt.want || got < tt.want-time.Second {
+			t.Errorf("WithTimeout(%s, %q) = %v, want %v", tt.operation, tt.header, got, tt.want)
+		}
+	}
+	if got := FormatTimeout(1500 * time.Millisecond); got != "1500" {
+		t.Errorf("FormatTimeout() = %s", got)
+	}
+	if got := FormatTimeout(time.Microsecond); got != "1" {
+		t.Errorf("FormatTimeout() under 1ms = %s", got)
+	}
+}
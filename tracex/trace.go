@@ -0,0 +1,19 @@
+// Package traceutil carries the trace id of a request in its context, it is shared by
+// the auth and logging packages so neither imports the other.
+package traceutil
+
+import "context"
+
+// TraceIDKey is the context key of the trace id shared by the kratos and go-kit middlewares.
+type TraceIDKey struct{}
+
+// NewTraceContext returns a new Context that carries the trace id.
+func NewTraceContext(ctx context.Context, traceID string) context.Context {
+	return context.WithValue(ctx, TraceIDKey{}, traceID)
+}
+
+// TraceIDFromContext returns the trace id in ctx if any.
+func TraceIDFromContext(ctx context.Context) (string, bool) {
+	traceID, ok := ctx.Value(TraceIDKey{}).(string)
+	return traceID, ok
+}